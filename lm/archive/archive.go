@@ -0,0 +1,418 @@
+// Package archive reads the files in zip and tar archives without extracting
+// them. A file in an archive is addressed by the path of the archive and the
+// name of the file within it, joined by "!/":
+//
+//	/music/gd1977-05-08.sbd.zip!/gd1977-05-08.sbd/gd77-05-08d1t01.flac
+//
+// Open, Stat, and ReadDir take either these paths or plain ones, so that
+// callers can treat archived files like any other.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Separator separates the path of an archive from the name of a file in it.
+const Separator = "!/"
+
+// extensions are the file name extensions of the supported archives.
+var extensions = []string{".zip", ".tar"}
+
+// IsArchive reports whether name is a supported archive, going by its
+// extension.
+func IsArchive(name string) bool {
+	name = strings.ToLower(name)
+	return slices.ContainsFunc(extensions, func(ext string) bool {
+		return strings.HasSuffix(name, ext)
+	})
+}
+
+// Split splits a path to a file in an archive into the path of the archive
+// and the name of the file within it. ok is false for plain paths.
+func Split(p string) (archivePath, name string, ok bool) {
+	for i := 0; ; {
+		j := strings.Index(p[i:], Separator)
+		if j < 0 {
+			return "", "", false
+		}
+		i += j
+		if IsArchive(p[:i]) {
+			return p[:i], p[i+len(Separator):], true
+		}
+		i += len(Separator)
+	}
+}
+
+// Join returns the path to the file called name in the archive at
+// archivePath.
+func Join(archivePath, name string) string {
+	return archivePath + Separator + name
+}
+
+// Entry is a regular file in an archive.
+type Entry struct {
+	// Name is the cleaned, slash separated path of the file in the archive.
+	Name string
+	Info fs.FileInfo
+}
+
+// List returns the regular files in the archive at archivePath, in the order
+// they're stored. Listings are cached until the archive changes, so that
+// looking up each of the files in a compressed archive doesn't decompress it
+// every time.
+func List(archivePath string) ([]Entry, error) {
+	stat, err := os.Stat(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	listingsMu.Lock()
+	l, ok := listings[archivePath]
+	listingsMu.Unlock()
+	if ok && l.same(stat) {
+		return l.entries, nil
+	}
+
+	var entries []Entry
+	err = walk(archivePath, func(name string, info fs.FileInfo, _ func() (File, error)) (bool, error) {
+		entries = append(entries, Entry{Name: name, Info: info})
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	listingsMu.Lock()
+	defer listingsMu.Unlock()
+	listings[archivePath] = &listing{version: versionOf(stat), entries: entries}
+	return entries, nil
+}
+
+var (
+	listingsMu sync.Mutex
+	listings   = map[string]*listing{}
+)
+
+// listing is the cached list of files in an archive.
+type listing struct {
+	version
+	entries []Entry
+}
+
+// version tells apart the contents of an archive over time.
+type version struct {
+	size    int64
+	modTime time.Time
+}
+
+func versionOf(info fs.FileInfo) version {
+	return version{size: info.Size(), modTime: info.ModTime()}
+}
+
+func (v version) same(info fs.FileInfo) bool {
+	return v == versionOf(info)
+}
+
+// File is an open file, which may be in an archive.
+type File interface {
+	io.ReadSeekCloser
+	Stat() (fs.FileInfo, error)
+}
+
+// Open opens the file at p, which may be in an archive. Files that are stored
+// uncompressed are read straight from the archive. Compressed ones are
+// decompressed into memory if they're small, and as they're read otherwise,
+// starting over from the beginning of the file when seeking backwards.
+func Open(p string) (File, error) {
+	archivePath, name, ok := Split(p)
+	if !ok {
+		return os.Open(p)
+	}
+
+	var file File
+	err := walk(archivePath, func(n string, _ fs.FileInfo, open func() (File, error)) (bool, error) {
+		if n != name {
+			return false, nil
+		}
+		var err error
+		file, err = open()
+		return true, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return nil, &fs.PathError{Op: "open", Path: p, Err: fs.ErrNotExist}
+	}
+	return file, nil
+}
+
+// Stat returns the file info for the file at p, which may be in an archive.
+func Stat(p string) (fs.FileInfo, error) {
+	archivePath, name, ok := Split(p)
+	if !ok {
+		return os.Stat(p)
+	}
+
+	entries, err := List(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.Name == name {
+			return e.Info, nil
+		}
+	}
+	return nil, &fs.PathError{Op: "stat", Path: p, Err: fs.ErrNotExist}
+}
+
+// ReadDir returns the files directly within the folder at dir, which may be
+// in an archive. Folders in archives aren't included.
+func ReadDir(dir string) ([]fs.DirEntry, error) {
+	archivePath, name, ok := Split(dir)
+	if !ok {
+		return os.ReadDir(dir)
+	}
+
+	entries, err := List(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	var files []fs.DirEntry
+	for _, e := range entries {
+		if path.Dir(e.Name) == path.Clean(name) {
+			files = append(files, fs.FileInfoToDirEntry(e.Info))
+		}
+	}
+	slices.SortFunc(files, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return files, nil
+}
+
+// walkFunc is called for each regular file in an archive, with a function
+// that opens it. It returns true to stop walking.
+type walkFunc func(name string, info fs.FileInfo, open func() (File, error)) (bool, error)
+
+// walk calls fn for each regular file in the archive at archivePath.
+func walk(archivePath string, fn walkFunc) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	// Files that are opened take over closing f
+	keep := false
+	defer func() {
+		if !keep {
+			f.Close()
+		}
+	}()
+
+	if strings.HasSuffix(strings.ToLower(archivePath), ".zip") {
+		keep, err = walkZip(f, fn)
+	} else {
+		keep, err = walkTar(f, fn)
+	}
+	if err != nil {
+		return fmt.Errorf("error reading archive %s: %v", archivePath, err)
+	}
+	return nil
+}
+
+func walkZip(f *os.File, fn walkFunc) (bool, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	r, err := zip.NewReader(f, stat.Size())
+	if err != nil {
+		return false, err
+	}
+
+	for _, zf := range r.File {
+		name, ok := cleanName(zf.Name)
+		if !ok || !zf.Mode().IsRegular() {
+			continue
+		}
+		info := zf.FileInfo()
+		size := int64(zf.UncompressedSize64)
+		inMemory := zf.Method != zip.Store && size <= maxInMemory
+		open := func() (File, error) {
+			switch {
+			case zf.Method == zip.Store:
+				offset, err := zf.DataOffset()
+				if err != nil {
+					return nil, err
+				}
+				return &entryFile{ReadSeeker: io.NewSectionReader(f, offset, size), info: info, closer: f}, nil
+			case inMemory:
+				rc, err := zf.Open()
+				if err != nil {
+					return nil, err
+				}
+				defer rc.Close()
+				b, err := io.ReadAll(rc)
+				if err != nil {
+					return nil, err
+				}
+				return &entryFile{ReadSeeker: bytes.NewReader(b), info: info}, nil
+			default:
+				return &entryFile{ReadSeeker: &stream{open: zf.Open, size: size}, info: info, closer: f}, nil
+			}
+		}
+
+		stop, err := fn(name, info, open)
+		if stop || err != nil {
+			// Files that aren't read into memory are read from f, so it's
+			// left open for them
+			return stop && err == nil && !inMemory, err
+		}
+	}
+	return false, nil
+}
+
+func walkTar(f *os.File, fn walkFunc) (bool, error) {
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		name, ok := cleanName(hdr.Name)
+		if !ok || hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		info := hdr.FileInfo()
+		open := func() (File, error) {
+			// The tar reader reads whole blocks, so f is at the start of the
+			// file's contents.
+			offset, err := f.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return nil, err
+			}
+			return &entryFile{ReadSeeker: io.NewSectionReader(f, offset, hdr.Size), info: info, closer: f}, nil
+		}
+
+		stop, err := fn(name, info, open)
+		if stop || err != nil {
+			return stop && err == nil, err
+		}
+	}
+}
+
+// maxInMemory is the size of the largest compressed file that's decompressed
+// into memory rather than as it's read.
+const maxInMemory = 1 << 20
+
+// stream is a compressed file that's decompressed as it's read. Seeking
+// forwards skips over the decompressed data, and seeking backwards starts
+// decompressing it again from the beginning.
+type stream struct {
+	open func() (io.ReadCloser, error)
+	size int64
+
+	rc io.ReadCloser
+	// pos is the offset the next Read reads from, and read is the offset rc
+	// has reached.
+	pos, read int64
+}
+
+func (s *stream) Read(p []byte) (int, error) {
+	if s.pos >= s.size {
+		return 0, io.EOF
+	}
+	if s.rc == nil || s.pos < s.read {
+		if err := s.Close(); err != nil {
+			return 0, err
+		}
+		rc, err := s.open()
+		if err != nil {
+			return 0, err
+		}
+		s.rc, s.read = rc, 0
+	}
+	if s.pos > s.read {
+		n, err := io.CopyN(io.Discard, s.rc, s.pos-s.read)
+		s.read += n
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := s.rc.Read(p)
+	s.read += int64(n)
+	s.pos = s.read
+	return n, err
+}
+
+func (s *stream) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		offset += s.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	s.pos = offset
+	return offset, nil
+}
+
+func (s *stream) Close() error {
+	if s.rc == nil {
+		return nil
+	}
+	err := s.rc.Close()
+	s.rc = nil
+	return err
+}
+
+// cleanName returns the slash separated path of a file in an archive, or
+// false for names that point outside of it.
+func cleanName(name string) (string, bool) {
+	name = path.Clean(strings.TrimPrefix(name, "/"))
+	if name == "." || name == ".." || strings.HasPrefix(name, "../") {
+		return "", false
+	}
+	return name, true
+}
+
+// entryFile is an open file in an archive.
+type entryFile struct {
+	io.ReadSeeker
+	info fs.FileInfo
+	// closer is the archive, for files read from it as they're read
+	closer io.Closer
+}
+
+func (f *entryFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *entryFile) Close() error {
+	var errs []error
+	if s, ok := f.ReadSeeker.(*stream); ok {
+		errs = append(errs, s.Close())
+	}
+	if f.closer != nil {
+		errs = append(errs, f.closer.Close())
+	}
+	return errors.Join(errs...)
+}
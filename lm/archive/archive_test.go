@@ -0,0 +1,65 @@
+package archive
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestStreamSeek(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	opens := 0
+	s := &stream{
+		open: func() (io.ReadCloser, error) {
+			opens++
+			return io.NopCloser(bytes.NewReader(data)), nil
+		},
+		size: int64(len(data)),
+	}
+	defer s.Close()
+
+	tests := []struct {
+		name   string
+		offset int64
+		whence int
+		want   int64
+		opens  int
+	}{
+		{"start", 0, io.SeekStart, 0, 1},
+		{"forwards", 500, io.SeekStart, 500, 1},
+		{"current", 10, io.SeekCurrent, 520, 1},
+		{"end", -10, io.SeekEnd, 990, 1},
+		{"backwards", 100, io.SeekStart, 100, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pos, err := s.Seek(tt.offset, tt.whence)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pos != tt.want {
+				t.Errorf("Seek() = %d, want %d", pos, tt.want)
+			}
+			b := make([]byte, 10)
+			if _, err := io.ReadFull(s, b); err != nil {
+				t.Fatal(err)
+			}
+			if want := data[tt.want : tt.want+10]; !bytes.Equal(b, want) {
+				t.Errorf("Read() = %v, want %v", b, want)
+			}
+			if opens != tt.opens {
+				t.Errorf("opened %d times, want %d", opens, tt.opens)
+			}
+		})
+	}
+
+	if _, err := s.Seek(0, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("Read() at end = %d, %v, want 0, EOF", n, err)
+	}
+}
@@ -0,0 +1,154 @@
+// Package aiff reads the format, audio data location, and tags of AIFF and
+// AIFF-C files.
+package aiff
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+const chunkHeaderSize = 8
+
+var (
+	ErrNotAIFF = errors.New("not an AIFF file")
+
+	// textNames maps the AIFF text chunk ids to tag names
+	textNames = map[string]string{
+		"ANNO": "comment",
+		"AUTH": "artist",
+		"NAME": "title",
+	}
+)
+
+// Chunk is the location of a chunk's data within a file.
+type Chunk struct {
+	Offset int64
+	Size   int64
+}
+
+// File describes an AIFF file.
+type File struct {
+	// Compression is the compression type of AIFF-C files, such as "sowt"
+	// for little endian samples, and "NONE" for AIFF files.
+	Compression   string
+	BitsPerSample int
+	Channels      int
+	SampleRate    int
+	Samples       int64
+	Duration      time.Duration
+
+	// Data is the audio, and ID3 is the ID3v2 tag, if any.
+	Data Chunk
+	ID3  *Chunk
+	// Text holds the tags from the text chunks, using Vorbis comment style
+	// names.
+	Text map[string]string
+}
+
+// Read reads the chunks of an AIFF file.
+func Read(rs io.ReadSeeker) (*File, error) {
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(rs, header); err != nil {
+		return nil, fmt.Errorf("error reading AIFF header: %v", err)
+	}
+	form := string(header[8:12])
+	if string(header[0:4]) != "FORM" || (form != "AIFF" && form != "AIFC") {
+		return nil, ErrNotAIFF
+	}
+
+	f := &File{Compression: "NONE", Text: map[string]string{}}
+	offset := int64(len(header))
+	for {
+		chunk := make([]byte, chunkHeaderSize)
+		if _, err := io.ReadFull(rs, chunk); err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("error reading AIFF chunk: %v", err)
+		}
+		id := string(chunk[0:4])
+		size := int64(binary.BigEndian.Uint32(chunk[4:8]))
+		offset += chunkHeaderSize
+
+		switch id {
+		case "COMM":
+			b, err := readChunk(rs, size, 18)
+			if err != nil {
+				return nil, err
+			}
+			f.Channels = int(binary.BigEndian.Uint16(b[0:2]))
+			f.Samples = int64(binary.BigEndian.Uint32(b[2:6]))
+			f.BitsPerSample = int(binary.BigEndian.Uint16(b[6:8]))
+			f.SampleRate = int(extendedToFloat(b[8:18]))
+			if form == "AIFC" && len(b) >= 22 {
+				f.Compression = string(b[18:22])
+			}
+		case "SSND":
+			// The samples start offset bytes after the offset and block
+			// size fields
+			b, err := readChunk(rs, min(size, 8), 8)
+			if err != nil {
+				return nil, err
+			}
+			skip := int64(binary.BigEndian.Uint32(b[0:4]))
+			f.Data = Chunk{Offset: offset + 8 + skip, Size: size - 8 - skip}
+		case "ID3 ", "id3 ":
+			f.ID3 = &Chunk{Offset: offset, Size: size}
+		case "ANNO", "AUTH", "NAME":
+			b, err := readChunk(rs, size, 0)
+			if err != nil {
+				return nil, err
+			}
+			f.Text[textNames[id]] = strings.TrimSpace(strings.TrimRight(string(b), "\x00"))
+		}
+
+		// Chunks are padded to an even size
+		offset += size + size&1
+		if _, err := rs.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	if f.Data.Offset == 0 {
+		return nil, fmt.Errorf("no SSND chunk found")
+	}
+	if f.SampleRate > 0 {
+		f.Duration = time.Duration(f.Samples) * time.Second / time.Duration(f.SampleRate)
+	}
+	return f, nil
+}
+
+// readChunk reads the data of a chunk, which must be at least minSize bytes.
+func readChunk(r io.Reader, size, minSize int64) ([]byte, error) {
+	if size < minSize {
+		return nil, fmt.Errorf("invalid AIFF chunk size %d", size)
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, fmt.Errorf("error reading AIFF chunk: %v", err)
+	}
+	return b, nil
+}
+
+// extendedToFloat converts an 80 bit IEEE 754 extended precision number, as
+// used for the sample rate, to a float64.
+func extendedToFloat(b []byte) float64 {
+	exponent := int(binary.BigEndian.Uint16(b[0:2]) & 0x7fff)
+	mantissa := binary.BigEndian.Uint64(b[2:10])
+	if exponent == 0 && mantissa == 0 {
+		return 0
+	}
+
+	f := math.Ldexp(float64(mantissa), exponent-16383-63)
+	if b[0]&0x80 != 0 {
+		f = -f
+	}
+	return f
+}
@@ -0,0 +1,115 @@
+// Package ape reads the properties of Monkey's Audio (APE) streams.
+package ape
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	// Version 3.98 moved the stream properties into a header that follows a
+	// descriptor.
+	descriptorVersion = 3980
+
+	flag8Bit  = 1 << 0
+	flag24Bit = 1 << 3
+
+	compressionExtraHigh = 4000
+)
+
+var (
+	Magic = []byte("MAC ")
+
+	ErrNotAPE = errors.New("not a Monkey's Audio stream")
+)
+
+// Properties describes a Monkey's Audio stream.
+type Properties struct {
+	// Version is the version of the encoder times 1000, such as 3990.
+	Version          int
+	CompressionLevel int
+	BitsPerSample    int
+	Channels         int
+	SampleRate       int
+	Samples          int64
+	Duration         time.Duration
+}
+
+// ReadProperties reads the header at the start of a Monkey's Audio stream.
+func ReadProperties(r io.Reader) (*Properties, error) {
+	start := make([]byte, 6)
+	if _, err := io.ReadFull(r, start); err != nil {
+		return nil, fmt.Errorf("error reading APE header: %v", err)
+	}
+	if !bytes.Equal(start[:4], Magic) {
+		return nil, ErrNotAPE
+	}
+
+	p := &Properties{Version: int(binary.LittleEndian.Uint16(start[4:6]))}
+	var blocksPerFrame, finalFrameBlocks, totalFrames uint32
+	if p.Version >= descriptorVersion {
+		// The rest of the descriptor, of which only its length matters
+		descriptor := make([]byte, 46)
+		if _, err := io.ReadFull(r, descriptor); err != nil {
+			return nil, fmt.Errorf("error reading APE descriptor: %v", err)
+		}
+		descriptorBytes := int64(binary.LittleEndian.Uint32(descriptor[2:6]))
+		if _, err := io.CopyN(io.Discard, r, descriptorBytes-52); err != nil {
+			return nil, fmt.Errorf("error reading APE descriptor: %v", err)
+		}
+
+		header := make([]byte, 24)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, fmt.Errorf("error reading APE header: %v", err)
+		}
+		p.CompressionLevel = int(binary.LittleEndian.Uint16(header[0:2]))
+		blocksPerFrame = binary.LittleEndian.Uint32(header[4:8])
+		finalFrameBlocks = binary.LittleEndian.Uint32(header[8:12])
+		totalFrames = binary.LittleEndian.Uint32(header[12:16])
+		p.BitsPerSample = int(binary.LittleEndian.Uint16(header[16:18]))
+		p.Channels = int(binary.LittleEndian.Uint16(header[18:20]))
+		p.SampleRate = int(binary.LittleEndian.Uint32(header[20:24]))
+	} else {
+		header := make([]byte, 26)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, fmt.Errorf("error reading APE header: %v", err)
+		}
+		p.CompressionLevel = int(binary.LittleEndian.Uint16(header[0:2]))
+		flags := binary.LittleEndian.Uint16(header[2:4])
+		p.Channels = int(binary.LittleEndian.Uint16(header[4:6]))
+		p.SampleRate = int(binary.LittleEndian.Uint32(header[6:10]))
+		totalFrames = binary.LittleEndian.Uint32(header[18:22])
+		finalFrameBlocks = binary.LittleEndian.Uint32(header[22:26])
+
+		switch {
+		case flags&flag8Bit != 0:
+			p.BitsPerSample = 8
+		case flags&flag24Bit != 0:
+			p.BitsPerSample = 24
+		default:
+			p.BitsPerSample = 16
+		}
+
+		// Older versions don't store the frame size
+		switch {
+		case p.Version >= 3950:
+			blocksPerFrame = 73728 * 4
+		case p.Version >= 3900 || (p.Version >= 3800 && p.CompressionLevel == compressionExtraHigh):
+			blocksPerFrame = 73728
+		default:
+			blocksPerFrame = 9216
+		}
+	}
+
+	if totalFrames > 0 {
+		p.Samples = int64(totalFrames-1)*int64(blocksPerFrame) + int64(finalFrameBlocks)
+	}
+	if p.SampleRate > 0 {
+		p.Duration = time.Duration(p.Samples) * time.Second / time.Duration(p.SampleRate)
+	}
+	return p, nil
+}
@@ -0,0 +1,134 @@
+// Package apetag reads APEv2 tags, which Monkey's Audio and WavPack files
+// store at the end of the file.
+package apetag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	footerSize = 32
+	id3v1Size  = 128
+
+	flagHasHeader = 1 << 31
+	// The item type is in bits 1 and 2 of the item flags
+	itemTypeMask = 0x6
+	itemTypeText = 0
+)
+
+var preamble = []byte("APETAGEX")
+
+// Tag is an APEv2 tag.
+type Tag struct {
+	// Items maps the lower case item keys to their values. Binary items,
+	// such as cover art, are left out.
+	Items map[string]string
+
+	// Offset is where the tag, including its header if it has one, starts,
+	// and Size is its length including the header and footer.
+	Offset int64
+	Size   int64
+}
+
+// Read reads the APEv2 tag at the end of a stream, which may be followed by
+// an ID3v1 tag. It returns nil if there isn't one.
+func Read(rs io.ReadSeeker) (*Tag, error) {
+	end, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	footer, err := readFooter(rs, end)
+	if err != nil {
+		return nil, err
+	}
+	if footer == nil && end >= id3v1Size && hasID3v1(rs, end) {
+		end -= id3v1Size
+		if footer, err = readFooter(rs, end); err != nil {
+			return nil, err
+		}
+	}
+	if footer == nil {
+		return nil, nil
+	}
+
+	// The size includes the items and footer, but not the header
+	size := int64(binary.LittleEndian.Uint32(footer[12:16]))
+	count := int(binary.LittleEndian.Uint32(footer[16:20]))
+	flags := binary.LittleEndian.Uint32(footer[20:24])
+	if size < footerSize || size > end {
+		return nil, fmt.Errorf("invalid APEv2 tag size %d", size)
+	}
+
+	t := &Tag{
+		Items:  map[string]string{},
+		Offset: end - size,
+		Size:   size,
+	}
+	if flags&flagHasHeader != 0 {
+		t.Offset -= footerSize
+		t.Size += footerSize
+	}
+
+	if _, err := rs.Seek(end-size, io.SeekStart); err != nil {
+		return nil, err
+	}
+	items := make([]byte, size-footerSize)
+	if _, err := io.ReadFull(rs, items); err != nil {
+		return nil, fmt.Errorf("error reading APEv2 tag: %v", err)
+	}
+
+	for range count {
+		if len(items) < 9 {
+			return nil, fmt.Errorf("invalid APEv2 tag: item runs past the end of the tag")
+		}
+		valueSize := int(binary.LittleEndian.Uint32(items[0:4]))
+		itemFlags := binary.LittleEndian.Uint32(items[4:8])
+		key, rest, ok := bytes.Cut(items[8:], []byte{0})
+		if !ok || valueSize > len(rest) {
+			return nil, fmt.Errorf("invalid APEv2 tag: item runs past the end of the tag")
+		}
+		if itemFlags&itemTypeMask == itemTypeText {
+			// Lists of values are separated by null bytes
+			value := strings.ReplaceAll(string(rest[:valueSize]), "\x00", ";")
+			t.Items[strings.ToLower(string(key))] = value
+		}
+		items = rest[valueSize:]
+	}
+
+	return t, nil
+}
+
+// readFooter returns the APEv2 footer that ends at end, or nil if there
+// isn't one.
+func readFooter(rs io.ReadSeeker, end int64) ([]byte, error) {
+	if end < footerSize {
+		return nil, nil
+	}
+	if _, err := rs.Seek(end-footerSize, io.SeekStart); err != nil {
+		return nil, err
+	}
+	footer := make([]byte, footerSize)
+	if _, err := io.ReadFull(rs, footer); err != nil {
+		return nil, fmt.Errorf("error reading APEv2 footer: %v", err)
+	}
+	if !bytes.Equal(footer[:8], preamble) {
+		return nil, nil
+	}
+	return footer, nil
+}
+
+func hasID3v1(rs io.ReadSeeker, size int64) bool {
+	if _, err := rs.Seek(size-id3v1Size, io.SeekStart); err != nil {
+		return false
+	}
+	tag := make([]byte, 3)
+	if _, err := io.ReadFull(rs, tag); err != nil {
+		return false
+	}
+	return bytes.Equal(tag, []byte("TAG"))
+}
@@ -0,0 +1,79 @@
+package apetag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// item returns an APEv2 item.
+func item(key, value string, flags uint32) []byte {
+	b := binary.LittleEndian.AppendUint32(nil, uint32(len(value)))
+	b = binary.LittleEndian.AppendUint32(b, flags)
+	b = append(b, key...)
+	b = append(b, 0)
+	return append(b, value...)
+}
+
+// tag returns an APEv2 tag with a header and footer around items.
+func tag(count int, items []byte) []byte {
+	size := len(items) + footerSize
+	block := func(flags uint32) []byte {
+		b := append([]byte{}, preamble...)
+		b = binary.LittleEndian.AppendUint32(b, 2000)
+		b = binary.LittleEndian.AppendUint32(b, uint32(size))
+		b = binary.LittleEndian.AppendUint32(b, uint32(count))
+		b = binary.LittleEndian.AppendUint32(b, flags)
+		return append(b, make([]byte, 8)...)
+	}
+	t := block(flagHasHeader)
+	t = append(t, items...)
+	return append(t, block(flagHasHeader)...)
+}
+
+func TestRead(t *testing.T) {
+	items := item("Artist", "Grateful Dead", 0)
+	items = append(items, item("Genre", "Rock\x00Live", 0)...)
+	items = append(items, item("Cover Art (Front)", "\x89PNG", 2)...)
+	audio := make([]byte, 100)
+
+	tests := []struct {
+		name   string
+		stream []byte
+	}{
+		{"at the end", append(audio, tag(3, items)...)},
+		{"before ID3v1", append(append(audio, tag(3, items)...), append([]byte("TAG"), make([]byte, 125)...)...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Read(bytes.NewReader(tt.stream))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := &Tag{
+				Items:  map[string]string{"artist": "Grateful Dead", "genre": "Rock;Live"},
+				Offset: 100,
+				Size:   int64(len(items) + 2*footerSize),
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Read() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestReadNoTag(t *testing.T) {
+	got, err := Read(bytes.NewReader(make([]byte, 100)))
+	if got != nil || err != nil {
+		t.Errorf("Read() = %+v, %v, want nil, nil", got, err)
+	}
+}
+
+func TestReadTruncated(t *testing.T) {
+	// The tag claims two items but only holds one
+	stream := append(make([]byte, 100), tag(2, item("Artist", "Grateful Dead", 0))...)
+	if _, err := Read(bytes.NewReader(stream)); err == nil {
+		t.Error("Read() error = nil, want an error")
+	}
+}
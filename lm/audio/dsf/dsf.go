@@ -0,0 +1,73 @@
+// Package dsf reads the properties of DSD stream files (DSF).
+package dsf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	dsdChunkSize = 28
+	fmtChunkSize = 52
+)
+
+var (
+	Magic = []byte("DSD ")
+
+	ErrNotDSF = errors.New("not a DSF file")
+)
+
+// File describes a DSF file.
+type File struct {
+	// BitsPerSample is 1 for DSD, or 8 for the rare files that store it
+	// with the least significant bit first.
+	BitsPerSample int
+	Channels      int
+	SampleRate    int
+	Samples       int64
+	Duration      time.Duration
+
+	// DataOffset and DataSize locate the audio, and MetadataOffset is the
+	// ID3v2 tag at the end of the file, or 0 if there isn't one.
+	DataOffset     int64
+	DataSize       int64
+	MetadataOffset int64
+}
+
+// Read reads the DSD, fmt, and data chunk headers at the start of a DSF file.
+func Read(r io.Reader) (*File, error) {
+	b := make([]byte, dsdChunkSize+fmtChunkSize+12)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, fmt.Errorf("error reading DSF header: %v", err)
+	}
+	if !bytes.Equal(b[0:4], Magic) {
+		return nil, ErrNotDSF
+	}
+
+	f := &File{MetadataOffset: int64(binary.LittleEndian.Uint64(b[20:28]))}
+	fmtChunk := b[dsdChunkSize:]
+	if string(fmtChunk[0:4]) != "fmt " {
+		return nil, fmt.Errorf("invalid DSF file: missing fmt chunk")
+	}
+	f.Channels = int(binary.LittleEndian.Uint32(fmtChunk[24:28]))
+	f.SampleRate = int(binary.LittleEndian.Uint32(fmtChunk[28:32]))
+	f.BitsPerSample = int(binary.LittleEndian.Uint32(fmtChunk[32:36]))
+	f.Samples = int64(binary.LittleEndian.Uint64(fmtChunk[36:44]))
+
+	data := b[dsdChunkSize+fmtChunkSize:]
+	if string(data[0:4]) != "data" {
+		return nil, fmt.Errorf("invalid DSF file: missing data chunk")
+	}
+	// The chunk size includes its 12 byte header
+	f.DataOffset = int64(len(b))
+	f.DataSize = int64(binary.LittleEndian.Uint64(data[4:12])) - 12
+
+	if f.SampleRate > 0 {
+		f.Duration = time.Duration(f.Samples) * time.Second / time.Duration(f.SampleRate)
+	}
+	return f, nil
+}
@@ -0,0 +1,62 @@
+package flac
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	mflac "github.com/mewkiz/flac"
+)
+
+// ComputeMD5 decodes the audio of a FLAC stream and computes the MD5 signature
+// of the unencoded audio data, as the encoder would have stored it in the
+// STREAMINFO block.
+func ComputeMD5(r io.Reader) ([16]byte, error) {
+	var sum [16]byte
+
+	stream, err := mflac.New(r)
+	if err != nil {
+		return sum, fmt.Errorf("error opening FLAC stream: %v", err)
+	}
+
+	h := md5.New()
+	for {
+		frame, err := stream.ParseNext()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return sum, fmt.Errorf("error decoding FLAC frame: %v", err)
+		}
+		frame.Hash(h)
+	}
+
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+// AudioMD5 returns the MD5 signature of the unencoded audio of a FLAC stream
+// as a lowercase hex string. The signature stored in the STREAMINFO block is
+// used when present. Otherwise it is computed by decoding the stream.
+func AudioMD5(rs io.ReadSeeker) (string, error) {
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	si, err := ReadStreamInfo(rs)
+	if err != nil {
+		return "", err
+	}
+	if si.HasMD5() {
+		return si.MD5String(), nil
+	}
+
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	sum, err := ComputeMD5(rs)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,125 @@
+// Package flac reads the properties of FLAC audio streams.
+package flac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	blockTypeStreamInfo = 0
+	streamInfoLength    = 34
+)
+
+var (
+	flacMagic = []byte("fLaC")
+	id3Magic  = []byte("ID3")
+
+	ErrNotFLAC = errors.New("not a FLAC stream")
+)
+
+// StreamInfo is the mandatory first metadata block of a FLAC stream.
+type StreamInfo struct {
+	MinBlockSize  uint16
+	MaxBlockSize  uint16
+	MinFrameSize  uint32
+	MaxFrameSize  uint32
+	SampleRate    uint32
+	Channels      uint8
+	BitsPerSample uint8
+	TotalSamples  uint64
+
+	// MD5 is the MD5 signature of the unencoded audio data. This is the value
+	// listed in FLAC fingerprint (.ffp) files. It is all zeros if the encoder
+	// didn't compute it.
+	MD5 [16]byte
+}
+
+// MD5String returns the audio MD5 signature as a lowercase hex string.
+func (si *StreamInfo) MD5String() string {
+	return hex.EncodeToString(si.MD5[:])
+}
+
+// HasMD5 reports whether the encoder stored an MD5 signature.
+func (si *StreamInfo) HasMD5() bool {
+	return si.MD5 != [16]byte{}
+}
+
+// ReadStreamInfo reads the STREAMINFO block from the start of a FLAC stream,
+// skipping over an ID3v2 tag if one was prepended to the stream.
+func ReadStreamInfo(r io.Reader) (*StreamInfo, error) {
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, fmt.Errorf("error reading FLAC header: %v", err)
+	}
+
+	if bytes.Equal(magic[:3], id3Magic) {
+		if err := skipID3v2(r, magic); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(r, magic); err != nil {
+			return nil, fmt.Errorf("error reading FLAC header: %v", err)
+		}
+	}
+	if !bytes.Equal(magic, flacMagic) {
+		return nil, ErrNotFLAC
+	}
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("error reading FLAC metadata block header: %v", err)
+	}
+	blockType := header[0] & 0x7f
+	length := uint32(header[1])<<16 | uint32(header[2])<<8 | uint32(header[3])
+	if blockType != blockTypeStreamInfo || length < streamInfoLength {
+		return nil, fmt.Errorf("invalid FLAC stream: first metadata block is type %d, length %d", blockType, length)
+	}
+
+	block := make([]byte, streamInfoLength)
+	if _, err := io.ReadFull(r, block); err != nil {
+		return nil, fmt.Errorf("error reading FLAC STREAMINFO: %v", err)
+	}
+
+	si := &StreamInfo{
+		MinBlockSize: binary.BigEndian.Uint16(block[0:2]),
+		MaxBlockSize: binary.BigEndian.Uint16(block[2:4]),
+		MinFrameSize: uint32(block[4])<<16 | uint32(block[5])<<8 | uint32(block[6]),
+		MaxFrameSize: uint32(block[7])<<16 | uint32(block[8])<<8 | uint32(block[9]),
+	}
+
+	// 20 bits sample rate, 3 bits channels - 1, 5 bits bits per sample - 1,
+	// 36 bits total samples
+	packed := binary.BigEndian.Uint64(block[10:18])
+	si.SampleRate = uint32(packed >> 44)
+	si.Channels = uint8(packed>>41&0x7) + 1
+	si.BitsPerSample = uint8(packed>>36&0x1f) + 1
+	si.TotalSamples = packed & 0xfffffffff
+	copy(si.MD5[:], block[18:34])
+
+	return si, nil
+}
+
+// skipID3v2 skips the rest of an ID3v2 tag whose first four bytes have
+// already been read.
+func skipID3v2(r io.Reader, start []byte) error {
+	header := make([]byte, 10)
+	copy(header, start)
+	if _, err := io.ReadFull(r, header[4:]); err != nil {
+		return fmt.Errorf("error reading ID3v2 header: %v", err)
+	}
+
+	// Size is a 28 bit synchsafe integer that excludes the header
+	size := int64(header[6])<<21 | int64(header[7])<<14 | int64(header[8])<<7 | int64(header[9])
+	if header[5]&0x10 != 0 {
+		// Footer present
+		size += 10
+	}
+	if _, err := io.CopyN(io.Discard, r, size); err != nil {
+		return fmt.Errorf("error skipping ID3v2 tag: %v", err)
+	}
+	return nil
+}
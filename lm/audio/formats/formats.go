@@ -0,0 +1,177 @@
+// Package formats is the registry of the audio formats that scan finds and
+// analyze reads. Each format has the file extensions it's found by, a check
+// of the bytes at the start of a file that identifies it, and readers for its
+// audio properties and tags. Formats can be enabled and disabled by name.
+package formats
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dhowden/tag"
+)
+
+// sniffSize is how much of the start of a file is read to identify it.
+const sniffSize = 512
+
+var (
+	ErrUnsupported = errors.New("unrecognized audio format")
+
+	id3Magic = []byte("ID3")
+)
+
+// Format is an audio file format.
+type Format struct {
+	// Name identifies the format when enabling and disabling it.
+	Name string
+	// Extensions are the lower case file extensions of the format,
+	// including the dot.
+	Extensions []string
+
+	// sniff reports whether header, the start of a file after any ID3v2 tag,
+	// is in this format.
+	sniff          func(header []byte) bool
+	readProperties func(rs io.ReadSeeker) (*Properties, error)
+	// readTags returns nil if the file has no tags.
+	readTags func(rs io.ReadSeeker) (tag.Metadata, error)
+	// contentHash hashes the audio, ignoring any tags.
+	contentHash func(rs io.ReadSeeker) (string, error)
+}
+
+// Properties are the technical properties of an audio stream. Bitrate is the
+// average in bits per second, or 0 if the stream doesn't record it. Lossy
+// streams have no bit depth.
+type Properties struct {
+	Codec      string
+	BitDepth   int
+	Bitrate    int
+	Channels   int
+	SampleRate int
+	Samples    int64
+	Duration   time.Duration
+}
+
+// ReadProperties reads the audio properties from the stream headers.
+func (f *Format) ReadProperties(rs io.ReadSeeker) (*Properties, error) {
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return f.readProperties(rs)
+}
+
+// ReadTags reads the tags, returning nil if there aren't any.
+func (f *Format) ReadTags(rs io.ReadSeeker) (tag.Metadata, error) {
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return f.readTags(rs)
+}
+
+// ContentHash returns a hash of the audio that ignores any tags, prefixed by
+// the kind of hash, such as "md5:" for the MD5 signature of decoded FLAC
+// audio or "sha1:" for a SHA-1 of the encoded audio.
+func (f *Format) ContentHash(rs io.ReadSeeker) (string, error) {
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return f.contentHash(rs)
+}
+
+// Names returns the names of all of the formats.
+func Names() []string {
+	names := []string{}
+	for _, f := range all {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+// Registry is a set of enabled formats.
+type Registry struct {
+	enabled     map[string]*Format
+	byExtension map[string]*Format
+}
+
+// New returns a registry of the formats named in include, or all of them if
+// include is empty, less those named in skip.
+func New(include, skip []string) (*Registry, error) {
+	for _, name := range slices.Concat(include, skip) {
+		if !slices.Contains(Names(), name) {
+			return nil, fmt.Errorf("unknown audio format %q, expected one of %s", name, strings.Join(Names(), ","))
+		}
+	}
+
+	r := &Registry{enabled: map[string]*Format{}, byExtension: map[string]*Format{}}
+	for _, f := range all {
+		if (len(include) > 0 && !slices.Contains(include, f.Name)) || slices.Contains(skip, f.Name) {
+			continue
+		}
+		r.enabled[f.Name] = f
+		for _, ext := range f.Extensions {
+			r.byExtension[ext] = f
+		}
+	}
+	return r, nil
+}
+
+// ForFile returns the enabled format with the extension of path, or nil if
+// there isn't one.
+func (r *Registry) ForFile(path string) *Format {
+	return r.byExtension[strings.ToLower(filepath.Ext(path))]
+}
+
+// Detect identifies the format of a file from the bytes at its start,
+// preferring the format of its extension when they match. It returns
+// ErrUnsupported if no format matches, and an error if the matching format
+// is disabled.
+func (r *Registry) Detect(rs io.ReadSeeker, filename string) (*Format, error) {
+	if _, err := skipID3v2(rs); err != nil {
+		return nil, err
+	}
+	header := make([]byte, sniffSize)
+	n, err := io.ReadFull(rs, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf("error reading %s: %v", filename, err)
+	}
+	header = header[:n]
+
+	if f := r.ForFile(filename); f != nil && f.sniff(header) {
+		return f, nil
+	}
+	for _, f := range all {
+		if !f.sniff(header) {
+			continue
+		}
+		if r.enabled[f.Name] == nil {
+			return nil, fmt.Errorf("%s audio is disabled", f.Name)
+		}
+		return f, nil
+	}
+	return nil, ErrUnsupported
+}
+
+// skipID3v2 seeks past the ID3v2 tag at the start of a stream, if there is
+// one, returning where the audio starts.
+func skipID3v2(rs io.ReadSeeker) (int64, error) {
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	header := make([]byte, 10)
+	start := int64(0)
+	if _, err := io.ReadFull(rs, header); err == nil && bytes.Equal(header[:3], id3Magic) {
+		// Size is a 28 bit synchsafe integer that excludes the header
+		start = int64(header[6])<<21 | int64(header[7])<<14 | int64(header[8])<<7 | int64(header[9]) + 10
+		if header[5]&0x10 != 0 {
+			// Footer present
+			start += 10
+		}
+	}
+	return rs.Seek(start, io.SeekStart)
+}
@@ -0,0 +1,480 @@
+package formats
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/dhowden/tag"
+	"github.com/organicveggie/livemusic/lm/audio/aiff"
+	"github.com/organicveggie/livemusic/lm/audio/ape"
+	"github.com/organicveggie/livemusic/lm/audio/apetag"
+	"github.com/organicveggie/livemusic/lm/audio/dsf"
+	"github.com/organicveggie/livemusic/lm/audio/flac"
+	"github.com/organicveggie/livemusic/lm/audio/mp3"
+	"github.com/organicveggie/livemusic/lm/audio/mp4"
+	"github.com/organicveggie/livemusic/lm/audio/ogg"
+	"github.com/organicveggie/livemusic/lm/audio/shn"
+	"github.com/organicveggie/livemusic/lm/audio/wav"
+	"github.com/organicveggie/livemusic/lm/audio/wavpack"
+)
+
+// all is every format, in the order they're tried when identifying a file.
+// MPEG audio is last, since its frame sync is the least distinctive.
+var all = []*Format{
+	{
+		Name:           "flac",
+		Extensions:     []string{".flac"},
+		sniff:          prefix([]byte("fLaC")),
+		readProperties: readFLACProperties,
+		readTags:       readTags,
+		contentHash: func(rs io.ReadSeeker) (string, error) {
+			sum, err := flac.AudioMD5(rs)
+			if err != nil {
+				return "", fmt.Errorf("error reading audio fingerprint: %v", err)
+			}
+			return "md5:" + sum, nil
+		},
+	},
+	{
+		Name:           "shn",
+		Extensions:     []string{".shn"},
+		sniff:          prefix([]byte("ajkg")),
+		readProperties: readShortenProperties,
+		// Shorten files have no tags
+		readTags:    func(io.ReadSeeker) (tag.Metadata, error) { return nil, nil },
+		contentHash: tagSum,
+	},
+	{
+		Name:           "ape",
+		Extensions:     []string{".ape"},
+		sniff:          prefix(ape.Magic),
+		readProperties: readAPEProperties,
+		readTags:       readAPETags,
+		contentHash:    sumUntilAPETag,
+	},
+	{
+		Name:           "wavpack",
+		Extensions:     []string{".wv"},
+		sniff:          prefix(wavpack.Magic),
+		readProperties: readWavPackProperties,
+		readTags:       readAPETags,
+		contentHash:    sumUntilAPETag,
+	},
+	{
+		Name:           "ogg",
+		Extensions:     []string{".ogg", ".oga"},
+		sniff:          func(header []byte) bool { return ogg.Identify(header) == ogg.CodecVorbis },
+		readProperties: readOggProperties,
+		readTags:       readTags,
+		contentHash:    oggSum,
+	},
+	{
+		Name:           "opus",
+		Extensions:     []string{".opus"},
+		sniff:          func(header []byte) bool { return ogg.Identify(header) == ogg.CodecOpus },
+		readProperties: readOggProperties,
+		readTags:       readTags,
+		contentHash:    oggSum,
+	},
+	{
+		Name:       "m4a",
+		Extensions: []string{".m4a"},
+		sniff: func(header []byte) bool {
+			return len(header) >= 8 && string(header[4:8]) == "ftyp"
+		},
+		readProperties: readMP4Properties,
+		readTags:       readTags,
+		contentHash: func(rs io.ReadSeeker) (string, error) {
+			return prefixSum(tag.SumAtoms(rs))
+		},
+	},
+	{
+		Name:       "wav",
+		Extensions: []string{".wav"},
+		sniff: func(header []byte) bool {
+			return len(header) >= 12 && (string(header[0:4]) == "RIFF" || string(header[0:4]) == "RF64") &&
+				string(header[8:12]) == "WAVE"
+		},
+		readProperties: readWAVProperties,
+		readTags:       readWAVTags,
+		contentHash: func(rs io.ReadSeeker) (string, error) {
+			f, err := wav.Read(rs)
+			if err != nil {
+				return "", err
+			}
+			return sumRange(rs, f.Data.Offset, f.Data.Offset+f.Data.Size)
+		},
+	},
+	{
+		Name:       "aiff",
+		Extensions: []string{".aif", ".aiff", ".aifc"},
+		sniff: func(header []byte) bool {
+			return len(header) >= 12 && string(header[0:4]) == "FORM" &&
+				(string(header[8:12]) == "AIFF" || string(header[8:12]) == "AIFC")
+		},
+		readProperties: readAIFFProperties,
+		readTags:       readAIFFTags,
+		contentHash: func(rs io.ReadSeeker) (string, error) {
+			f, err := aiff.Read(rs)
+			if err != nil {
+				return "", err
+			}
+			return sumRange(rs, f.Data.Offset, f.Data.Offset+f.Data.Size)
+		},
+	},
+	{
+		Name:           "dsf",
+		Extensions:     []string{".dsf"},
+		sniff:          prefix(dsf.Magic),
+		readProperties: readDSFProperties,
+		readTags:       readDSFTags,
+		contentHash: func(rs io.ReadSeeker) (string, error) {
+			f, err := dsf.Read(rs)
+			if err != nil {
+				return "", err
+			}
+			return sumRange(rs, f.DataOffset, f.DataOffset+f.DataSize)
+		},
+	},
+	{
+		Name:       "mp3",
+		Extensions: []string{".mp3"},
+		sniff: func(header []byte) bool {
+			return len(header) >= 2 && header[0] == 0xff && header[1]&0xe0 == 0xe0
+		},
+		readProperties: readMP3Properties,
+		readTags:       readTags,
+		contentHash:    tagSum,
+	},
+}
+
+func prefix(magic []byte) func(header []byte) bool {
+	return func(header []byte) bool {
+		return bytes.HasPrefix(header, magic)
+	}
+}
+
+// readTags reads the tags of the formats that the tag package supports.
+func readTags(rs io.ReadSeeker) (tag.Metadata, error) {
+	m, err := tag.ReadFrom(rs)
+	if errors.Is(err, tag.ErrNoTagsFound) {
+		return nil, nil
+	}
+	return m, err
+}
+
+// tagSum hashes the audio without any ID3 or MP4 metadata.
+func tagSum(rs io.ReadSeeker) (string, error) {
+	return prefixSum(tag.Sum(rs))
+}
+
+// oggSum hashes the audio packets of an Ogg stream, leaving out the headers
+// that hold its tags.
+func oggSum(rs io.ReadSeeker) (string, error) {
+	return prefixSum(ogg.AudioSum(rs))
+}
+
+func prefixSum(sum string, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	return "sha1:" + sum, nil
+}
+
+// sumRange hashes the bytes of a stream from start up to end.
+func sumRange(rs io.ReadSeeker, start, end int64) (string, error) {
+	if _, err := rs.Seek(start, io.SeekStart); err != nil {
+		return "", err
+	}
+	h := sha1.New()
+	if _, err := io.CopyN(h, rs, end-start); err != nil {
+		return "", fmt.Errorf("error reading audio: %v", err)
+	}
+	return fmt.Sprintf("sha1:%x", h.Sum(nil)), nil
+}
+
+func readFLACProperties(rs io.ReadSeeker) (*Properties, error) {
+	si, err := flac.ReadStreamInfo(rs)
+	if err != nil {
+		return nil, fmt.Errorf("error reading FLAC STREAMINFO: %v", err)
+	}
+	p := &Properties{
+		Codec:      "flac",
+		BitDepth:   int(si.BitsPerSample),
+		Channels:   int(si.Channels),
+		SampleRate: int(si.SampleRate),
+		Samples:    int64(si.TotalSamples),
+	}
+	if si.SampleRate > 0 {
+		p.Duration = time.Duration(si.TotalSamples) * time.Second / time.Duration(si.SampleRate)
+	}
+	return p, nil
+}
+
+func readMP3Properties(rs io.ReadSeeker) (*Properties, error) {
+	mp, err := mp3.ReadProperties(rs)
+	if err != nil {
+		return nil, fmt.Errorf("error reading MPEG audio properties: %v", err)
+	}
+	return &Properties{
+		Codec:      "mp3",
+		Channels:   mp.Channels,
+		SampleRate: mp.SampleRate,
+		Samples:    mp.Samples,
+		Duration:   mp.Duration,
+		Bitrate:    mp.Bitrate,
+	}, nil
+}
+
+// readShortenProperties reads the audio properties of a Shorten file. The
+// sample count comes from the embedded WAV header when it has one, otherwise
+// the whole file is decoded to count the samples.
+func readShortenProperties(rs io.ReadSeeker) (*Properties, error) {
+	header, err := shn.ReadHeader(rs)
+	if err != nil {
+		return nil, fmt.Errorf("error reading Shorten header: %v", err)
+	}
+	p := &Properties{
+		Codec:      "shn",
+		BitDepth:   header.BitsPerSample,
+		Channels:   header.Channels,
+		SampleRate: header.SampleRate,
+		Samples:    header.Samples(),
+		Duration:   header.Duration(),
+	}
+
+	if p.Samples == 0 && p.SampleRate > 0 {
+		if _, err := rs.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if _, p.Samples, err = shn.AudioMD5(rs); err != nil {
+			return nil, fmt.Errorf("error decoding Shorten audio: %v", err)
+		}
+		p.Duration = time.Duration(p.Samples) * time.Second / time.Duration(p.SampleRate)
+	}
+	return p, nil
+}
+
+func readAPEProperties(rs io.ReadSeeker) (*Properties, error) {
+	if _, err := skipID3v2(rs); err != nil {
+		return nil, err
+	}
+	ap, err := ape.ReadProperties(rs)
+	if err != nil {
+		return nil, fmt.Errorf("error reading Monkey's Audio header: %v", err)
+	}
+	return &Properties{
+		Codec:      "ape",
+		BitDepth:   ap.BitsPerSample,
+		Channels:   ap.Channels,
+		SampleRate: ap.SampleRate,
+		Samples:    ap.Samples,
+		Duration:   ap.Duration,
+	}, nil
+}
+
+func readWavPackProperties(rs io.ReadSeeker) (*Properties, error) {
+	if _, err := skipID3v2(rs); err != nil {
+		return nil, err
+	}
+	wp, err := wavpack.ReadProperties(rs)
+	if err != nil {
+		return nil, fmt.Errorf("error reading WavPack header: %v", err)
+	}
+	return &Properties{
+		Codec:      "wavpack",
+		BitDepth:   wp.BitsPerSample,
+		Channels:   wp.Channels,
+		SampleRate: wp.SampleRate,
+		Samples:    wp.Samples,
+		Duration:   wp.Duration,
+	}, nil
+}
+
+// readAPETags reads the APEv2 tag of Monkey's Audio and WavPack files,
+// falling back to ID3 tags for files tagged by tools that don't write APEv2.
+func readAPETags(rs io.ReadSeeker) (tag.Metadata, error) {
+	t, err := apetag.Read(rs)
+	if err != nil {
+		return nil, fmt.Errorf("error reading APEv2 tag: %v", err)
+	}
+	if t != nil {
+		return newTextTags(t.Items), nil
+	}
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return readTags(rs)
+}
+
+// sumUntilAPETag hashes the audio between any ID3v2 tag at the start and the
+// APEv2 or ID3v1 tag at the end.
+func sumUntilAPETag(rs io.ReadSeeker) (string, error) {
+	t, err := apetag.Read(rs)
+	if err != nil {
+		return "", fmt.Errorf("error reading APEv2 tag: %v", err)
+	}
+	end, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return "", err
+	}
+	if t != nil {
+		end = t.Offset
+	} else if end >= 128 {
+		trailer := make([]byte, 3)
+		if _, err := rs.Seek(end-128, io.SeekStart); err != nil {
+			return "", err
+		}
+		if _, err := io.ReadFull(rs, trailer); err == nil && string(trailer) == "TAG" {
+			end -= 128
+		}
+	}
+
+	start, err := skipID3v2(rs)
+	if err != nil {
+		return "", err
+	}
+	return sumRange(rs, start, end)
+}
+
+func readOggProperties(rs io.ReadSeeker) (*Properties, error) {
+	op, err := ogg.ReadProperties(rs)
+	if err != nil {
+		return nil, fmt.Errorf("error reading Ogg stream: %v", err)
+	}
+	return &Properties{
+		Codec:      string(op.Codec),
+		Bitrate:    op.NominalBitrate,
+		Channels:   op.Channels,
+		SampleRate: op.SampleRate,
+		Samples:    op.Samples,
+		Duration:   op.Duration,
+	}, nil
+}
+
+func readMP4Properties(rs io.ReadSeeker) (*Properties, error) {
+	mp, err := mp4.ReadProperties(rs)
+	if err != nil {
+		return nil, fmt.Errorf("error reading MPEG-4 audio track: %v", err)
+	}
+	p := &Properties{
+		Codec:      "aac",
+		BitDepth:   mp.BitsPerSample,
+		Channels:   mp.Channels,
+		SampleRate: mp.SampleRate,
+		Samples:    mp.Samples,
+		Duration:   mp.Duration,
+	}
+	if mp.Lossless() {
+		p.Codec = "alac"
+	} else if mp.Codec != "mp4a" {
+		p.Codec = mp.Codec
+	}
+	return p, nil
+}
+
+func readWAVProperties(rs io.ReadSeeker) (*Properties, error) {
+	f, err := wav.Read(rs)
+	if err != nil {
+		return nil, fmt.Errorf("error reading WAV header: %v", err)
+	}
+	return &Properties{
+		Codec:      "wav",
+		BitDepth:   f.BitsPerSample,
+		Channels:   f.Channels,
+		SampleRate: f.SampleRate,
+		Samples:    f.Samples,
+		Duration:   f.Duration,
+	}, nil
+}
+
+// readWAVTags reads the ID3v2 chunk of a WAV file, or else its RIFF INFO
+// tags.
+func readWAVTags(rs io.ReadSeeker) (tag.Metadata, error) {
+	f, err := wav.Read(rs)
+	if err != nil {
+		return nil, fmt.Errorf("error reading WAV header: %v", err)
+	}
+	if f.ID3 != nil {
+		return readID3Chunk(rs, f.ID3.Offset)
+	}
+	if len(f.Info) > 0 {
+		return newTextTags(f.Info), nil
+	}
+	return nil, nil
+}
+
+func readAIFFProperties(rs io.ReadSeeker) (*Properties, error) {
+	f, err := aiff.Read(rs)
+	if err != nil {
+		return nil, fmt.Errorf("error reading AIFF header: %v", err)
+	}
+	return &Properties{
+		Codec:      "aiff",
+		BitDepth:   f.BitsPerSample,
+		Channels:   f.Channels,
+		SampleRate: f.SampleRate,
+		Samples:    f.Samples,
+		Duration:   f.Duration,
+	}, nil
+}
+
+// readAIFFTags reads the ID3v2 chunk of an AIFF file, or else its text
+// chunks.
+func readAIFFTags(rs io.ReadSeeker) (tag.Metadata, error) {
+	f, err := aiff.Read(rs)
+	if err != nil {
+		return nil, fmt.Errorf("error reading AIFF header: %v", err)
+	}
+	if f.ID3 != nil {
+		return readID3Chunk(rs, f.ID3.Offset)
+	}
+	if len(f.Text) > 0 {
+		return newTextTags(f.Text), nil
+	}
+	return nil, nil
+}
+
+func readID3Chunk(rs io.ReadSeeker, offset int64) (tag.Metadata, error) {
+	if _, err := rs.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	m, err := tag.ReadID3v2Tags(rs)
+	if err != nil {
+		return nil, fmt.Errorf("error reading ID3v2 chunk: %v", err)
+	}
+	return m, nil
+}
+
+func readDSFProperties(rs io.ReadSeeker) (*Properties, error) {
+	f, err := dsf.Read(rs)
+	if err != nil {
+		return nil, fmt.Errorf("error reading DSF header: %v", err)
+	}
+	return &Properties{
+		Codec:      "dsd",
+		BitDepth:   1,
+		Channels:   f.Channels,
+		SampleRate: f.SampleRate,
+		Samples:    f.Samples,
+		Duration:   f.Duration,
+	}, nil
+}
+
+func readDSFTags(rs io.ReadSeeker) (tag.Metadata, error) {
+	f, err := dsf.Read(rs)
+	if err != nil {
+		return nil, fmt.Errorf("error reading DSF header: %v", err)
+	}
+	if f.MetadataOffset == 0 {
+		return nil, nil
+	}
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return tag.ReadDSFTags(rs)
+}
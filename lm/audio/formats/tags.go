@@ -0,0 +1,75 @@
+package formats
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/dhowden/tag"
+)
+
+// textTags are tags stored as plain name and value pairs, such as APEv2 items
+// and RIFF INFO chunks. Names are lower case and follow the Vorbis comment
+// conventions, so that they're read the same way as FLAC and Ogg tags.
+type textTags map[string]string
+
+// aliases maps the names some taggers use to the Vorbis comment names.
+var aliases = map[string]string{
+	"album artist": "albumartist",
+	"disc":         "discnumber",
+	"track":        "tracknumber",
+	"year":         "date",
+}
+
+func newTextTags(items map[string]string) textTags {
+	t := textTags{}
+	for k, v := range items {
+		t[strings.ToLower(k)] = v
+	}
+	for alias, name := range aliases {
+		if v, ok := t[alias]; ok && t[name] == "" {
+			t[name] = v
+		}
+	}
+	return t
+}
+
+func (t textTags) Format() tag.Format     { return tag.UnknownFormat }
+func (t textTags) FileType() tag.FileType { return tag.UnknownFileType }
+func (t textTags) Title() string          { return t["title"] }
+func (t textTags) Album() string          { return t["album"] }
+func (t textTags) Artist() string         { return t["artist"] }
+func (t textTags) AlbumArtist() string    { return t["albumartist"] }
+func (t textTags) Composer() string       { return t["composer"] }
+func (t textTags) Genre() string          { return t["genre"] }
+func (t textTags) Picture() *tag.Picture  { return nil }
+func (t textTags) Lyrics() string         { return t["lyrics"] }
+func (t textTags) Comment() string        { return t["comment"] }
+
+func (t textTags) Year() int {
+	year, _ := strconv.Atoi(t["date"][:min(4, len(t["date"]))])
+	return year
+}
+
+func (t textTags) Track() (int, int) {
+	return parseOf(t["tracknumber"])
+}
+
+func (t textTags) Disc() (int, int) {
+	return parseOf(t["discnumber"])
+}
+
+func (t textTags) Raw() map[string]interface{} {
+	raw := map[string]interface{}{}
+	for k, v := range t {
+		raw[k] = v
+	}
+	return raw
+}
+
+// parseOf parses a number and total written as "3/12".
+func parseOf(s string) (int, int) {
+	n, total, _ := strings.Cut(s, "/")
+	x, _ := strconv.Atoi(strings.TrimSpace(n))
+	y, _ := strconv.Atoi(strings.TrimSpace(total))
+	return x, y
+}
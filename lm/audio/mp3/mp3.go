@@ -0,0 +1,322 @@
+// Package mp3 reads the properties of MPEG audio streams from their frame
+// headers and, for variable bitrate streams, their Xing, LAME, or VBRI headers.
+package mp3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	mpeg25 = 0
+	mpeg2  = 2
+	mpeg1  = 3
+
+	layer3 = 1
+	layer2 = 2
+	layer1 = 3
+
+	channelModeMono = 3
+
+	// maxSyncSearch limits how far past the ID3v2 tag to look for the first
+	// frame.
+	maxSyncSearch = 64 * 1024
+)
+
+var (
+	ErrNoFrame = errors.New("no MPEG audio frame found")
+
+	// Bitrates in kbps, indexed by [version is MPEG1][layer][index]
+	bitrates = [2][4][16]int{
+		{ // MPEG2 and 2.5
+			{},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+		},
+		{ // MPEG1
+			{},
+			{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+			{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+		},
+	}
+
+	// Sample rates indexed by [version][index]
+	sampleRates = [4][3]int{
+		mpeg25: {11025, 12000, 8000},
+		mpeg2:  {22050, 24000, 16000},
+		mpeg1:  {44100, 48000, 32000},
+	}
+)
+
+// Properties describes an MPEG audio stream.
+type Properties struct {
+	Version     string
+	Layer       int
+	SampleRate  int
+	Channels    int
+	Samples     int64
+	Duration    time.Duration
+	Bitrate     int
+	VBR         bool
+	EncoderInfo string
+}
+
+type frameHeader struct {
+	version     int
+	layer       int
+	bitrate     int
+	sampleRate  int
+	padding     int
+	channelMode int
+}
+
+func parseFrameHeader(b []byte) (frameHeader, bool) {
+	if len(b) < 4 || b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+		return frameHeader{}, false
+	}
+
+	h := frameHeader{
+		version:     int(b[1]>>3) & 0x3,
+		layer:       int(b[1]>>1) & 0x3,
+		padding:     int(b[2]>>1) & 0x1,
+		channelMode: int(b[3]>>6) & 0x3,
+	}
+	bitrateIndex := int(b[2]>>4) & 0xf
+	sampleRateIndex := int(b[2]>>2) & 0x3
+	if h.version == 1 || h.layer == 0 || bitrateIndex == 0xf || sampleRateIndex == 3 {
+		return frameHeader{}, false
+	}
+
+	isMPEG1 := 0
+	if h.version == mpeg1 {
+		isMPEG1 = 1
+	}
+	h.bitrate = bitrates[isMPEG1][h.layer][bitrateIndex] * 1000
+	h.sampleRate = sampleRates[h.version][sampleRateIndex]
+	if h.bitrate == 0 {
+		// Free format streams aren't supported
+		return frameHeader{}, false
+	}
+	return h, true
+}
+
+func (h frameHeader) samplesPerFrame() int {
+	switch {
+	case h.layer == layer1:
+		return 384
+	case h.layer == layer3 && h.version != mpeg1:
+		return 576
+	default:
+		return 1152
+	}
+}
+
+func (h frameHeader) frameSize() int {
+	if h.layer == layer1 {
+		return (12*h.bitrate/h.sampleRate + h.padding) * 4
+	}
+	return h.samplesPerFrame()/8*h.bitrate/h.sampleRate + h.padding
+}
+
+func (h frameHeader) channels() int {
+	if h.channelMode == channelModeMono {
+		return 1
+	}
+	return 2
+}
+
+// sideInfoSize is the size of the layer III side information, which the Xing
+// header follows.
+func (h frameHeader) sideInfoSize() int {
+	mono := h.channelMode == channelModeMono
+	switch {
+	case h.version == mpeg1 && mono:
+		return 17
+	case h.version == mpeg1:
+		return 32
+	case mono:
+		return 9
+	default:
+		return 17
+	}
+}
+
+func (h frameHeader) versionName() string {
+	switch h.version {
+	case mpeg1:
+		return "MPEG-1"
+	case mpeg2:
+		return "MPEG-2"
+	default:
+		return "MPEG-2.5"
+	}
+}
+
+// ReadProperties reads the properties of an MPEG audio stream. The duration
+// of constant bitrate streams is estimated from the size of the stream.
+func ReadProperties(rs io.ReadSeeker) (*Properties, error) {
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	start, err := id3v2Size(rs)
+	if err != nil {
+		return nil, err
+	}
+	end := size
+	if hasID3v1(rs, size) {
+		end -= 128
+	}
+
+	if _, err := rs.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, maxSyncSearch)
+	n, err := io.ReadFull(rs, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("error reading MPEG audio: %v", err)
+	}
+	buf = buf[:n]
+
+	offset, h, ok := findFrame(buf)
+	if !ok {
+		return nil, ErrNoFrame
+	}
+
+	p := &Properties{
+		Version:    h.versionName(),
+		Layer:      4 - h.layer,
+		SampleRate: h.sampleRate,
+		Channels:   h.channels(),
+		Bitrate:    h.bitrate,
+	}
+
+	frame := buf[offset:]
+	audioBytes := end - start - int64(offset)
+	frames := int64(0)
+	delay, padding := 0, 0
+
+	if h.layer == layer3 {
+		if xing := frame[min(len(frame), 4+h.sideInfoSize()):]; len(xing) >= 8 &&
+			(bytes.Equal(xing[:4], []byte("Xing")) || bytes.Equal(xing[:4], []byte("Info"))) {
+			p.VBR = string(xing[:4]) == "Xing"
+			frames, audioBytes, delay, padding, p.EncoderInfo = parseXing(xing, audioBytes)
+		} else if vbri := frame[min(len(frame), 36):]; len(vbri) >= 18 && bytes.Equal(vbri[:4], []byte("VBRI")) {
+			p.VBR = true
+			audioBytes = int64(binary.BigEndian.Uint32(vbri[10:14]))
+			frames = int64(binary.BigEndian.Uint32(vbri[14:18]))
+			delay = int(binary.BigEndian.Uint16(vbri[6:8]))
+		}
+	}
+
+	if frames > 0 {
+		p.Samples = frames*int64(h.samplesPerFrame()) - int64(delay+padding)
+		p.Duration = time.Duration(p.Samples) * time.Second / time.Duration(h.sampleRate)
+		if p.Duration > 0 {
+			p.Bitrate = int(float64(audioBytes*8) / p.Duration.Seconds())
+		}
+	} else {
+		p.Duration = time.Duration(float64(audioBytes*8) / float64(h.bitrate) * float64(time.Second))
+		p.Samples = int64(p.Duration) * int64(h.sampleRate) / int64(time.Second)
+	}
+
+	return p, nil
+}
+
+// findFrame returns the offset of the first frame header in buf that is
+// followed by another valid frame header, to avoid false syncs.
+func findFrame(buf []byte) (int, frameHeader, bool) {
+	for i := 0; i+4 <= len(buf); i++ {
+		h, ok := parseFrameHeader(buf[i:])
+		if !ok {
+			continue
+		}
+
+		next := i + h.frameSize()
+		if next+4 > len(buf) {
+			return i, h, true
+		}
+		if nh, ok := parseFrameHeader(buf[next:]); ok && nh.version == h.version && nh.layer == h.layer {
+			return i, h, true
+		}
+	}
+	return 0, frameHeader{}, false
+}
+
+// parseXing parses a Xing or Info header and the LAME extension that may
+// follow it.
+func parseXing(b []byte, audioBytes int64) (frames, bytesTotal int64, delay, padding int, encoder string) {
+	bytesTotal = audioBytes
+	flags := binary.BigEndian.Uint32(b[4:8])
+	pos := 8
+	if flags&0x1 != 0 && len(b) >= pos+4 {
+		frames = int64(binary.BigEndian.Uint32(b[pos : pos+4]))
+		pos += 4
+	}
+	if flags&0x2 != 0 && len(b) >= pos+4 {
+		bytesTotal = int64(binary.BigEndian.Uint32(b[pos : pos+4]))
+		pos += 4
+	}
+	if flags&0x4 != 0 {
+		pos += 100
+	}
+	if flags&0x8 != 0 {
+		pos += 4
+	}
+
+	// The LAME extension holds the encoder version and the encoder delay and
+	// padding, which aren't part of the decoded audio.
+	if len(b) >= pos+24 {
+		lame := b[pos:]
+		if bytes.HasPrefix(lame, []byte("LAME")) || bytes.HasPrefix(lame, []byte("Lavc")) || bytes.HasPrefix(lame, []byte("Lavf")) {
+			encoder = string(bytes.TrimRight(lame[:9], "\x00 "))
+			delay = int(lame[21])<<4 | int(lame[22])>>4
+			padding = int(lame[22]&0xf)<<8 | int(lame[23])
+		}
+	}
+	return frames, bytesTotal, delay, padding, encoder
+}
+
+// id3v2Size returns the size of the ID3v2 tag at the start of the stream, or
+// 0 if there isn't one.
+func id3v2Size(rs io.ReadSeeker) (int64, error) {
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(rs, header); err != nil {
+		return 0, nil
+	}
+	if !bytes.Equal(header[:3], []byte("ID3")) {
+		return 0, nil
+	}
+
+	size := int64(header[6])<<21 | int64(header[7])<<14 | int64(header[8])<<7 | int64(header[9])
+	size += 10
+	if header[5]&0x10 != 0 {
+		size += 10
+	}
+	return size, nil
+}
+
+func hasID3v1(rs io.ReadSeeker, size int64) bool {
+	if size < 128 {
+		return false
+	}
+	if _, err := rs.Seek(size-128, io.SeekStart); err != nil {
+		return false
+	}
+	tag := make([]byte, 3)
+	if _, err := io.ReadFull(rs, tag); err != nil {
+		return false
+	}
+	return bytes.Equal(tag, []byte("TAG"))
+}
@@ -0,0 +1,78 @@
+package mp3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+// frame returns an MPEG-1 layer III, 128 kbps, 44.1 kHz stereo frame.
+func frame() []byte {
+	f := make([]byte, 417)
+	copy(f, []byte{0xff, 0xfb, 0x90, 0x00})
+	return f
+}
+
+func TestReadPropertiesCBR(t *testing.T) {
+	// An ID3v2 tag, which is skipped, and 100 frames
+	stream := append([]byte("ID3\x03\x00\x00\x00\x00\x00\x0a"), make([]byte, 10)...)
+	for range 100 {
+		stream = append(stream, frame()...)
+	}
+
+	p, err := ReadProperties(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Properties{
+		Version:    "MPEG-1",
+		Layer:      3,
+		SampleRate: 44100,
+		Channels:   2,
+		Samples:    114935,
+		Duration:   2606250 * time.Microsecond,
+		Bitrate:    128000,
+	}
+	if *p != *want {
+		t.Errorf("ReadProperties() = %+v, want %+v", p, want)
+	}
+}
+
+func TestReadPropertiesXing(t *testing.T) {
+	// A Xing header follows the side information in the first frame. The
+	// stream is large enough that its bitrate overflows in integer
+	// nanoseconds.
+	first := frame()
+	xing := first[4+32:]
+	copy(xing, "Xing")
+	binary.BigEndian.PutUint32(xing[4:], 0x3)
+	binary.BigEndian.PutUint32(xing[8:], 38281)
+	binary.BigEndian.PutUint32(xing[12:], 2_000_000_000)
+	stream := append(first, frame()...)
+
+	p, err := ReadProperties(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.VBR {
+		t.Error("VBR = false, want true")
+	}
+	if want := 38281 * 1152; p.Samples != int64(want) {
+		t.Errorf("Samples = %d, want %d", p.Samples, want)
+	}
+	if want := 1000 * time.Second; p.Duration.Round(time.Second) != want {
+		t.Errorf("Duration = %v, want %v", p.Duration, want)
+	}
+	if p.Bitrate < 15_900_000 || p.Bitrate > 16_100_000 {
+		t.Errorf("Bitrate = %d, want about 16000000", p.Bitrate)
+	}
+}
+
+func TestReadPropertiesNoFrame(t *testing.T) {
+	_, err := ReadProperties(bytes.NewReader(make([]byte, 1000)))
+	if !errors.Is(err, ErrNoFrame) {
+		t.Errorf("ReadProperties() error = %v, want %v", err, ErrNoFrame)
+	}
+}
@@ -0,0 +1,274 @@
+// Package mp4 reads the properties of the audio track in an MPEG-4 (M4A)
+// file, which is usually AAC or Apple Lossless (ALAC).
+package mp4
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	boxHeaderSize = 8
+
+	// audioSampleEntrySize is the size of the fields of an audio sample
+	// entry that precede its child boxes.
+	audioSampleEntrySize = 28
+)
+
+var (
+	ErrNotMP4       = errors.New("not an MPEG-4 file")
+	ErrNoAudioTrack = errors.New("no audio track found")
+)
+
+// Properties describes the first audio track of an MPEG-4 file.
+type Properties struct {
+	// Codec is the four character code of the track's sample entry, such as
+	// "mp4a" for AAC and "alac" for Apple Lossless.
+	Codec         string
+	BitsPerSample int
+	Channels      int
+	SampleRate    int
+	Samples       int64
+	Duration      time.Duration
+}
+
+// Lossless reports whether the track is Apple Lossless.
+func (p *Properties) Lossless() bool {
+	return p.Codec == "alac"
+}
+
+// box is the position of a box's content within the file.
+type box struct {
+	typ    string
+	offset int64
+	size   int64
+}
+
+// ReadProperties finds the first audio track in an MPEG-4 file and reads its
+// properties.
+func ReadProperties(rs io.ReadSeeker) (*Properties, error) {
+	end, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	top, err := readBoxes(rs, 0, end)
+	if err != nil {
+		return nil, err
+	}
+	if len(top) == 0 || top[0].typ != "ftyp" {
+		return nil, ErrNotMP4
+	}
+
+	moov := find(top, "moov")
+	if moov == nil {
+		return nil, fmt.Errorf("no moov box found")
+	}
+	traks, err := readBoxes(rs, moov.offset, moov.size)
+	if err != nil {
+		return nil, err
+	}
+	for _, trak := range traks {
+		if trak.typ != "trak" {
+			continue
+		}
+		p, err := readTrack(rs, trak)
+		if err != nil || p != nil {
+			return p, err
+		}
+	}
+	return nil, ErrNoAudioTrack
+}
+
+// readTrack returns the properties of a track, or nil if it isn't audio.
+func readTrack(rs io.ReadSeeker, trak box) (*Properties, error) {
+	mdia, err := child(rs, trak, "mdia")
+	if err != nil || mdia == nil {
+		return nil, err
+	}
+	boxes, err := readBoxes(rs, mdia.offset, mdia.size)
+	if err != nil {
+		return nil, err
+	}
+
+	hdlr := find(boxes, "hdlr")
+	if hdlr == nil {
+		return nil, nil
+	}
+	handler, err := readAt(rs, hdlr.offset, 12)
+	if err != nil {
+		return nil, err
+	}
+	if string(handler[8:12]) != "soun" {
+		return nil, nil
+	}
+
+	p := &Properties{}
+	var timescale, duration uint64
+	if mdhd := find(boxes, "mdhd"); mdhd != nil {
+		if timescale, duration, err = readMediaHeader(rs, mdhd); err != nil {
+			return nil, err
+		}
+	}
+
+	stbl, err := path(rs, boxes, "minf", "stbl")
+	if err != nil {
+		return nil, err
+	}
+	if stbl != nil {
+		stsd, err := child(rs, *stbl, "stsd")
+		if err != nil {
+			return nil, err
+		}
+		if stsd != nil {
+			if err := p.readSampleEntry(rs, stsd); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if timescale > 0 {
+		// The timescale is usually, but not always, the sample rate
+		p.SampleRate = cmp.Or(p.SampleRate, int(timescale))
+		p.Samples = int64(duration * uint64(p.SampleRate) / timescale)
+		p.Duration = time.Duration(duration) * time.Second / time.Duration(timescale)
+	}
+	return p, nil
+}
+
+// readMediaHeader returns the timescale and the duration in units of it
+// from an mdhd box.
+func readMediaHeader(rs io.ReadSeeker, mdhd *box) (uint64, uint64, error) {
+	b, err := readAt(rs, mdhd.offset, min(mdhd.size, 32))
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(b) >= 32 && b[0] == 1 {
+		return uint64(binary.BigEndian.Uint32(b[20:24])), binary.BigEndian.Uint64(b[24:32]), nil
+	} else if len(b) >= 20 {
+		return uint64(binary.BigEndian.Uint32(b[12:16])), uint64(binary.BigEndian.Uint32(b[16:20])), nil
+	}
+	return 0, 0, nil
+}
+
+// readSampleEntry reads the audio format from the first entry of an stsd box.
+func (p *Properties) readSampleEntry(rs io.ReadSeeker, stsd *box) error {
+	// Version, flags, and entry count precede the entries
+	entries, err := readBoxes(rs, stsd.offset+8, stsd.size-8)
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+	entry := entries[0]
+	p.Codec = entry.typ
+
+	b, err := readAt(rs, entry.offset, audioSampleEntrySize)
+	if err != nil {
+		return err
+	}
+	p.Channels = int(binary.BigEndian.Uint16(b[16:18]))
+	p.BitsPerSample = int(binary.BigEndian.Uint16(b[18:20]))
+	// The sample rate is 16.16 fixed point
+	p.SampleRate = int(binary.BigEndian.Uint32(b[24:28]) >> 16)
+
+	if entry.typ != "alac" {
+		// Lossy codecs have no bit depth
+		p.BitsPerSample = 0
+		return nil
+	}
+
+	// The ALAC magic cookie has the real format
+	config, err := readBoxes(rs, entry.offset+audioSampleEntrySize, entry.size-audioSampleEntrySize)
+	if err != nil {
+		return err
+	}
+	if alac := find(config, "alac"); alac != nil && alac.size >= 28 {
+		cookie, err := readAt(rs, alac.offset, 28)
+		if err != nil {
+			return err
+		}
+		p.BitsPerSample = int(cookie[9])
+		p.Channels = int(cookie[13])
+		p.SampleRate = int(binary.BigEndian.Uint32(cookie[24:28]))
+	}
+	return nil
+}
+
+// readBoxes lists the boxes in size bytes starting at offset.
+func readBoxes(rs io.ReadSeeker, offset, size int64) ([]box, error) {
+	boxes := []box{}
+	end := offset + size
+	for offset+boxHeaderSize <= end {
+		header, err := readAt(rs, offset, boxHeaderSize)
+		if err != nil {
+			return nil, err
+		}
+		b := box{typ: string(header[4:8]), offset: offset + boxHeaderSize}
+		length := int64(binary.BigEndian.Uint32(header[0:4]))
+		switch length {
+		case 0:
+			// The box runs to the end of its parent
+			length = end - offset
+		case 1:
+			large, err := readAt(rs, offset+boxHeaderSize, 8)
+			if err != nil {
+				return nil, err
+			}
+			length = int64(binary.BigEndian.Uint64(large))
+			b.offset += 8
+		}
+		if length < b.offset-offset || offset+length > end {
+			return nil, fmt.Errorf("invalid MPEG-4 box %q at %d", b.typ, offset)
+		}
+		b.size = offset + length - b.offset
+		boxes = append(boxes, b)
+		offset += length
+	}
+	return boxes, nil
+}
+
+func find(boxes []box, typ string) *box {
+	for i := range boxes {
+		if boxes[i].typ == typ {
+			return &boxes[i]
+		}
+	}
+	return nil
+}
+
+func child(rs io.ReadSeeker, parent box, typ string) (*box, error) {
+	boxes, err := readBoxes(rs, parent.offset, parent.size)
+	if err != nil {
+		return nil, err
+	}
+	return find(boxes, typ), nil
+}
+
+// path follows the box types down from boxes, returning nil if any of them
+// is missing.
+func path(rs io.ReadSeeker, boxes []box, types ...string) (*box, error) {
+	b := find(boxes, types[0])
+	for _, typ := range types[1:] {
+		if b == nil {
+			return nil, nil
+		}
+		var err error
+		if b, err = child(rs, *b, typ); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func readAt(rs io.ReadSeeker, offset, n int64) ([]byte, error) {
+	if _, err := rs.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rs, b); err != nil {
+		return nil, fmt.Errorf("error reading MPEG-4 box: %v", err)
+	}
+	return b, nil
+}
@@ -0,0 +1,99 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+func mkbox(typ string, children ...[]byte) []byte {
+	content := bytes.Join(children, nil)
+	b := binary.BigEndian.AppendUint32(nil, uint32(boxHeaderSize+len(content)))
+	b = append(b, typ...)
+	return append(b, content...)
+}
+
+// file returns an MPEG-4 file with a single track of the given handler type
+// and sample entry, lasting 90 seconds at a 44.1 kHz timescale.
+func file(handler string, entry []byte) []byte {
+	mdhd := make([]byte, 20)
+	binary.BigEndian.PutUint32(mdhd[12:], 44100)
+	binary.BigEndian.PutUint32(mdhd[16:], 90*44100)
+	hdlr := append(make([]byte, 8), handler...)
+	stsd := append(make([]byte, 8), entry...)
+
+	return append(mkbox("ftyp", []byte("M4A \x00\x00\x00\x00")),
+		mkbox("moov", mkbox("trak", mkbox("mdia",
+			mkbox("mdhd", mdhd),
+			mkbox("hdlr", hdlr, make([]byte, 12)),
+			mkbox("minf", mkbox("stbl", mkbox("stsd", stsd))),
+		)))...)
+}
+
+// sampleEntry returns an audio sample entry of the given codec.
+func sampleEntry(codec string, channels, bits, rate int, children ...[]byte) []byte {
+	b := make([]byte, audioSampleEntrySize)
+	binary.BigEndian.PutUint16(b[16:], uint16(channels))
+	binary.BigEndian.PutUint16(b[18:], uint16(bits))
+	binary.BigEndian.PutUint32(b[24:], uint32(rate)<<16)
+	return mkbox(codec, append([][]byte{b}, children...)...)
+}
+
+func TestReadProperties(t *testing.T) {
+	// The ALAC magic cookie holds the real format
+	cookie := make([]byte, 28)
+	cookie[9] = 24
+	cookie[13] = 2
+	binary.BigEndian.PutUint32(cookie[24:], 96000)
+
+	tests := []struct {
+		name  string
+		entry []byte
+		want  Properties
+	}{
+		{"aac", sampleEntry("mp4a", 2, 16, 44100), Properties{Codec: "mp4a", Channels: 2, SampleRate: 44100}},
+		{"alac", sampleEntry("alac", 2, 16, 44100, mkbox("alac", cookie)), Properties{Codec: "alac", BitsPerSample: 24, Channels: 2, SampleRate: 96000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ReadProperties(bytes.NewReader(file("soun", tt.entry)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.want
+			want.Samples = int64(90 * want.SampleRate)
+			want.Duration = 90 * time.Second
+			if *p != want {
+				t.Errorf("ReadProperties() = %+v, want %+v", p, want)
+			}
+		})
+	}
+}
+
+func TestReadPropertiesErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file []byte
+		want error
+	}{
+		{"not mp4", mkbox("RIFF", make([]byte, 8)), ErrNotMP4},
+		{"video only", file("vide", sampleEntry("avc1", 0, 0, 0)), ErrNoAudioTrack},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadProperties(bytes.NewReader(tt.file)); !errors.Is(err, tt.want) {
+				t.Errorf("ReadProperties() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadPropertiesInvalidBox(t *testing.T) {
+	// The moov box claims to be larger than the file
+	f := append(mkbox("ftyp", []byte("M4A \x00\x00\x00\x00")), 0, 0, 1, 0, 'm', 'o', 'o', 'v')
+	if _, err := ReadProperties(bytes.NewReader(f)); err == nil {
+		t.Error("ReadProperties() error = nil, want an error")
+	}
+}
@@ -0,0 +1,235 @@
+// Package ogg reads the properties of Vorbis and Opus streams in an Ogg
+// container.
+package ogg
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	pageHeaderSize = 27
+
+	// maxLastPageSearch limits how far from the end to look for the last
+	// page, whose granule position is the length of the stream.
+	maxLastPageSearch = 64 * 1024
+
+	// Opus always decodes at 48kHz, whatever the rate of the input was.
+	opusSampleRate = 48000
+
+	// Vorbis streams start with identification, comment, and setup header
+	// packets, and Opus streams with identification and comment ones.
+	vorbisHeaderPackets = 3
+	opusHeaderPackets   = 2
+)
+
+var (
+	Magic = []byte("OggS")
+
+	vorbisHeader = []byte("\x01vorbis")
+	opusHeader   = []byte("OpusHead")
+
+	ErrNotOgg        = errors.New("not an Ogg stream")
+	ErrUnknownStream = errors.New("Ogg stream is neither Vorbis nor Opus")
+)
+
+// Codec is the codec of the first logical stream in an Ogg container.
+type Codec string
+
+const (
+	CodecUnknown Codec = ""
+	CodecVorbis  Codec = "vorbis"
+	CodecOpus    Codec = "opus"
+)
+
+// Properties describes a Vorbis or Opus stream.
+type Properties struct {
+	Codec    Codec
+	Channels int
+	// SampleRate is the rate the stream decodes at. For Opus this is always
+	// 48kHz, and InputSampleRate is the rate of the audio that was encoded.
+	SampleRate      int
+	InputSampleRate int
+	Samples         int64
+	Duration        time.Duration
+	// NominalBitrate is the average bitrate the Vorbis encoder aimed for,
+	// if it set one.
+	NominalBitrate int
+}
+
+// Identify returns the codec of the stream that the first page in header
+// starts.
+func Identify(header []byte) Codec {
+	if len(header) < pageHeaderSize || !bytes.Equal(header[:4], Magic) {
+		return CodecUnknown
+	}
+	packet := header[min(len(header), pageHeaderSize+int(header[26])):]
+	switch {
+	case bytes.HasPrefix(packet, vorbisHeader):
+		return CodecVorbis
+	case bytes.HasPrefix(packet, opusHeader):
+		return CodecOpus
+	}
+	return CodecUnknown
+}
+
+// ReadProperties reads the identification header from the first page of an
+// Ogg stream, and the length of the stream from the last page.
+func ReadProperties(rs io.ReadSeeker) (*Properties, error) {
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	header := make([]byte, pageHeaderSize)
+	if _, err := io.ReadFull(rs, header); err != nil {
+		return nil, fmt.Errorf("error reading Ogg page: %v", err)
+	}
+	if !bytes.Equal(header[:4], Magic) {
+		return nil, ErrNotOgg
+	}
+	serial := binary.LittleEndian.Uint32(header[14:18])
+
+	lacing := make([]byte, header[26])
+	if _, err := io.ReadFull(rs, lacing); err != nil {
+		return nil, fmt.Errorf("error reading Ogg page: %v", err)
+	}
+	size := 0
+	for _, n := range lacing {
+		size += int(n)
+		if n < 255 {
+			break
+		}
+	}
+	packet := make([]byte, size)
+	if _, err := io.ReadFull(rs, packet); err != nil {
+		return nil, fmt.Errorf("error reading Ogg packet: %v", err)
+	}
+
+	p := &Properties{}
+	preSkip := int64(0)
+	switch {
+	case bytes.HasPrefix(packet, vorbisHeader) && len(packet) >= 28:
+		p.Codec = CodecVorbis
+		p.Channels = int(packet[11])
+		p.SampleRate = int(binary.LittleEndian.Uint32(packet[12:16]))
+		p.InputSampleRate = p.SampleRate
+		p.NominalBitrate = max(int(int32(binary.LittleEndian.Uint32(packet[20:24]))), 0)
+	case bytes.HasPrefix(packet, opusHeader) && len(packet) >= 19:
+		p.Codec = CodecOpus
+		p.Channels = int(packet[9])
+		preSkip = int64(binary.LittleEndian.Uint16(packet[10:12]))
+		p.SampleRate = opusSampleRate
+		p.InputSampleRate = int(binary.LittleEndian.Uint32(packet[12:16]))
+	default:
+		return nil, ErrUnknownStream
+	}
+
+	granule, err := lastGranule(rs, serial)
+	if err != nil {
+		return nil, err
+	}
+	p.Samples = max(granule-preSkip, 0)
+	if p.SampleRate > 0 {
+		p.Duration = time.Duration(p.Samples) * time.Second / time.Duration(p.SampleRate)
+	}
+	return p, nil
+}
+
+// lastGranule returns the granule position of the last page of the logical
+// stream, which is the number of samples in it.
+func lastGranule(rs io.ReadSeeker, serial uint32) (int64, error) {
+	end, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	start := max(end-maxLastPageSearch, 0)
+	if _, err := rs.Seek(start, io.SeekStart); err != nil {
+		return 0, err
+	}
+	buf := make([]byte, end-start)
+	if _, err := io.ReadFull(rs, buf); err != nil {
+		return 0, fmt.Errorf("error reading the end of the Ogg stream: %v", err)
+	}
+
+	for i := bytes.LastIndex(buf, Magic); i >= 0; i = bytes.LastIndex(buf[:i], Magic) {
+		page := buf[i:]
+		if len(page) < pageHeaderSize || binary.LittleEndian.Uint32(page[14:18]) != serial {
+			continue
+		}
+		// Pages that no packet ends on have a granule position of -1
+		if granule := int64(binary.LittleEndian.Uint64(page[6:14])); granule >= 0 {
+			return granule, nil
+		}
+	}
+	return 0, fmt.Errorf("no Ogg page with a granule position found in the last %d bytes", len(buf))
+}
+
+// AudioSum returns the hex encoded SHA-1 of the audio packets of the first
+// logical stream in an Ogg container. The header packets are left out, since
+// the tags are in one of them, as is the paging, which changes when the tags
+// do.
+func AudioSum(rs io.ReadSeeker) (string, error) {
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	r := bufio.NewReader(rs)
+	h := sha1.New()
+
+	var serial uint32
+	headerPackets, packets := -1, 0
+	header := make([]byte, pageHeaderSize)
+	for {
+		if _, err := io.ReadFull(r, header); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return "", fmt.Errorf("error reading Ogg page: %v", err)
+		}
+		if !bytes.Equal(header[:4], Magic) {
+			return "", ErrNotOgg
+		}
+		lacing := make([]byte, header[26])
+		if _, err := io.ReadFull(r, lacing); err != nil {
+			return "", fmt.Errorf("error reading Ogg page: %v", err)
+		}
+		size := 0
+		for _, n := range lacing {
+			size += int(n)
+		}
+		body := make([]byte, size)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return "", fmt.Errorf("error reading Ogg page: %v", err)
+		}
+
+		if headerPackets < 0 {
+			serial = binary.LittleEndian.Uint32(header[14:18])
+			switch {
+			case bytes.HasPrefix(body, vorbisHeader):
+				headerPackets = vorbisHeaderPackets
+			case bytes.HasPrefix(body, opusHeader):
+				headerPackets = opusHeaderPackets
+			default:
+				return "", ErrUnknownStream
+			}
+		} else if binary.LittleEndian.Uint32(header[14:18]) != serial {
+			continue
+		}
+
+		// A packet is split into segments of 255 bytes, ending with a shorter
+		// one.
+		for _, n := range lacing {
+			if packets >= headerPackets {
+				h.Write(body[:n])
+			}
+			body = body[n:]
+			if n < 255 {
+				packets++
+			}
+		}
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
@@ -0,0 +1,129 @@
+package ogg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+// page returns an Ogg page of the given stream holding a single packet.
+func page(serial uint32, granule int64, packet []byte) []byte {
+	p := append([]byte{}, Magic...)
+	p = append(p, 0, 0)
+	p = binary.LittleEndian.AppendUint64(p, uint64(granule))
+	p = binary.LittleEndian.AppendUint32(p, serial)
+	p = append(p, make([]byte, 8)...) // sequence number and checksum
+	p = append(p, 1, byte(len(packet)))
+	return append(p, packet...)
+}
+
+func vorbisIdent() []byte {
+	b := append([]byte{}, vorbisHeader...)
+	b = append(b, 0, 0, 0, 0, 2)
+	b = binary.LittleEndian.AppendUint32(b, 44100)
+	b = binary.LittleEndian.AppendUint32(b, 0)
+	b = binary.LittleEndian.AppendUint32(b, 192000)
+	b = binary.LittleEndian.AppendUint32(b, 0)
+	return append(b, 0xb8, 1)
+}
+
+func opusIdent() []byte {
+	b := append([]byte{}, opusHeader...)
+	b = append(b, 1, 2)
+	b = binary.LittleEndian.AppendUint16(b, 312)
+	b = binary.LittleEndian.AppendUint32(b, 44100)
+	return append(b, 0, 0, 0)
+}
+
+func TestReadProperties(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream []byte
+		want   Properties
+	}{
+		{
+			"vorbis",
+			bytes.Join([][]byte{page(7, 0, vorbisIdent()), page(7, 441000, []byte("audio"))}, nil),
+			Properties{Codec: CodecVorbis, Channels: 2, SampleRate: 44100, InputSampleRate: 44100, Samples: 441000, Duration: 10 * time.Second, NominalBitrate: 192000},
+		},
+		{
+			// The last page of another stream and a page that no packet
+			// ends on are skipped
+			"opus",
+			bytes.Join([][]byte{page(7, 0, opusIdent()), page(7, 480312, []byte("audio")), page(7, -1, []byte("audio")), page(8, 99, []byte("other"))}, nil),
+			Properties{Codec: CodecOpus, Channels: 2, SampleRate: 48000, InputSampleRate: 44100, Samples: 480000, Duration: 10 * time.Second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if codec := Identify(tt.stream); codec != tt.want.Codec {
+				t.Errorf("Identify() = %q, want %q", codec, tt.want.Codec)
+			}
+			p, err := ReadProperties(bytes.NewReader(tt.stream))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *p != tt.want {
+				t.Errorf("ReadProperties() = %+v, want %+v", p, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadPropertiesErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream []byte
+		want   error
+	}{
+		{"not ogg", append([]byte("fLaC"), make([]byte, 40)...), ErrNotOgg},
+		{"flac in ogg", page(7, 0, []byte("\x7fFLAC\x01\x00")), ErrUnknownStream},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadProperties(bytes.NewReader(tt.stream)); !errors.Is(err, tt.want) {
+				t.Errorf("ReadProperties() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAudioSum(t *testing.T) {
+	vorbis := func(comment string, audio ...string) []byte {
+		pages := [][]byte{page(7, 0, vorbisIdent()), page(7, 0, []byte("\x03vorbis"+comment)), page(7, 0, []byte("\x05vorbis"))}
+		for _, a := range audio {
+			pages = append(pages, page(7, 0, []byte(a)))
+		}
+		return bytes.Join(pages, nil)
+	}
+	opus := func(comment string) []byte {
+		return bytes.Join([][]byte{page(7, 0, opusIdent()), page(7, 0, []byte("OpusTags"+comment)), page(8, 0, []byte("other")), page(7, 0, []byte("audio"))}, nil)
+	}
+
+	sum := func(stream []byte) string {
+		t.Helper()
+		s, err := AudioSum(bytes.NewReader(stream))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	tests := []struct {
+		name string
+		a, b []byte
+		same bool
+	}{
+		{"vorbis retagged", vorbis("artist=a", "audio"), vorbis("artist=another", "audio"), true},
+		{"vorbis audio", vorbis("artist=a", "audio"), vorbis("artist=a", "other audio"), false},
+		{"opus retagged", opus("artist=a"), opus("artist=another"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if same := sum(tt.a) == sum(tt.b); same != tt.same {
+				t.Errorf("AudioSum() equal = %v, want %v", same, tt.same)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package shn
+
+import (
+	"bufio"
+	"io"
+)
+
+// bitReader reads a most significant bit first bit stream.
+type bitReader struct {
+	r     *bufio.Reader
+	cache uint64
+	n     uint
+}
+
+func newBitReader(r io.Reader) *bitReader {
+	return &bitReader{r: bufio.NewReaderSize(r, 64*1024)}
+}
+
+func (b *bitReader) fill() error {
+	for b.n <= 56 {
+		c, err := b.r.ReadByte()
+		if err != nil {
+			if b.n > 0 && err == io.EOF {
+				return nil
+			}
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		b.cache |= uint64(c) << (56 - b.n)
+		b.n += 8
+	}
+	return nil
+}
+
+// bits reads n bits, where n <= 32.
+func (b *bitReader) bits(n uint) (uint32, error) {
+	if n == 0 {
+		return 0, nil
+	}
+	if b.n < n {
+		if err := b.fill(); err != nil {
+			return 0, err
+		}
+		if b.n < n {
+			return 0, io.ErrUnexpectedEOF
+		}
+	}
+	v := uint32(b.cache >> (64 - n))
+	b.cache <<= n
+	b.n -= n
+	return v, nil
+}
+
+// unary counts the zero bits before the next one bit, consuming both.
+func (b *bitReader) unary() (uint32, error) {
+	count := uint32(0)
+	for {
+		if b.n == 0 {
+			if err := b.fill(); err != nil {
+				return 0, err
+			}
+		}
+		if b.cache == 0 {
+			count += uint32(b.n)
+			b.n = 0
+			continue
+		}
+
+		// Count leading zeros within the cached bits
+		for b.cache&(1<<63) == 0 {
+			b.cache <<= 1
+			b.n--
+			count++
+		}
+		b.cache <<= 1
+		b.n--
+		return count, nil
+	}
+}
+
+// uvar reads an unsigned Rice code with k low bits.
+func (b *bitReader) uvar(k uint) (uint32, error) {
+	high, err := b.unary()
+	if err != nil {
+		return 0, err
+	}
+	low, err := b.bits(k)
+	if err != nil {
+		return 0, err
+	}
+	return high<<k | low, nil
+}
+
+// svar reads a signed Rice code with k low bits.
+func (b *bitReader) svar(k uint) (int32, error) {
+	u, err := b.uvar(k + 1)
+	if err != nil {
+		return 0, err
+	}
+	if u&1 != 0 {
+		return ^int32(u >> 1), nil
+	}
+	return int32(u >> 1), nil
+}
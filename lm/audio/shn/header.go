@@ -0,0 +1,102 @@
+package shn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// parseVerbatim reads the audio format from the embedded WAV or AIFF header.
+// A header that can't be parsed leaves the format unknown rather than failing,
+// since the samples can still be decoded.
+func (d *Decoder) parseVerbatim() {
+	h := &d.Header
+	v := h.Verbatim
+
+	switch {
+	case len(v) >= 12 && bytes.Equal(v[0:4], []byte("RIFF")) && bytes.Equal(v[8:12], []byte("WAVE")):
+		parseWAV(h, v[12:])
+	case len(v) >= 12 && bytes.Equal(v[0:4], []byte("FORM")) && bytes.Equal(v[8:12], []byte("AIFF")):
+		parseAIFF(h, v[12:])
+	}
+
+	if h.BitsPerSample == 0 {
+		switch h.FileType {
+		case TypeS8, TypeU8:
+			h.BitsPerSample = 8
+		default:
+			h.BitsPerSample = 16
+		}
+	}
+}
+
+func parseWAV(h *Header, chunks []byte) {
+	for len(chunks) >= 8 {
+		id := string(chunks[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunks[4:8]))
+		body := chunks[8:]
+
+		switch id {
+		case "fmt ":
+			if len(body) >= 16 {
+				h.SampleRate = int(binary.LittleEndian.Uint32(body[4:8]))
+				h.BitsPerSample = int(binary.LittleEndian.Uint16(body[14:16]))
+			}
+		case "data":
+			// The data chunk is the last part of the verbatim header
+			h.DataSize = size
+			return
+		}
+
+		size += size & 1
+		if size > int64(len(body)) {
+			return
+		}
+		chunks = body[size:]
+	}
+}
+
+func parseAIFF(h *Header, chunks []byte) {
+	for len(chunks) >= 8 {
+		id := string(chunks[0:4])
+		size := int64(binary.BigEndian.Uint32(chunks[4:8]))
+		body := chunks[8:]
+
+		switch id {
+		case "COMM":
+			if len(body) >= 18 {
+				frames := int64(binary.BigEndian.Uint32(body[2:6]))
+				h.BitsPerSample = int(binary.BigEndian.Uint16(body[6:8]))
+				h.SampleRate = int(ExtendedToFloat(body[8:18]))
+				h.DataSize = frames * int64(h.Channels*((h.BitsPerSample+7)/8))
+			}
+		case "SSND":
+			return
+		}
+
+		size += size & 1
+		if size > int64(len(body)) {
+			return
+		}
+		chunks = body[size:]
+	}
+}
+
+// ExtendedToFloat converts an 80 bit IEEE 754 extended precision number, as
+// used for the sample rate in AIFF files, to a float64.
+func ExtendedToFloat(b []byte) float64 {
+	if len(b) < 10 {
+		return 0
+	}
+	exponent := int(binary.BigEndian.Uint16(b[0:2]) & 0x7fff)
+	mantissa := binary.BigEndian.Uint64(b[2:10])
+	if exponent == 0 && mantissa == 0 {
+		return 0
+	}
+
+	f := math.Ldexp(float64(mantissa), exponent-16383-63)
+	if b[0]&0x80 != 0 {
+		f = -f
+	}
+	return f
+}
@@ -0,0 +1,56 @@
+package shn
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// AudioMD5 decodes a Shorten stream and returns the MD5 checksum of the
+// decoded audio data, as listed in shntool st5 manifests, along with the
+// number of samples per channel.
+func AudioMD5(r io.Reader) (string, int64, error) {
+	d, err := NewDecoder(r)
+	if err != nil {
+		return "", 0, err
+	}
+
+	h := md5.New()
+	samples := int64(0)
+	buf := []byte{}
+	for {
+		block, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", 0, fmt.Errorf("error decoding Shorten audio: %v", err)
+		}
+
+		buf = d.appendSamples(buf[:0], block)
+		h.Write(buf)
+		samples += int64(len(block[0]))
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), samples, nil
+}
+
+// appendSamples appends a block of samples, interleaved and in the byte order
+// of the original file, to buf.
+func (d *Decoder) appendSamples(buf []byte, block [][]int32) []byte {
+	for i := range block[0] {
+		for _, ch := range block {
+			s := ch[i]
+			switch d.Header.FileType {
+			case TypeS8, TypeU8:
+				buf = append(buf, byte(s))
+			case TypeS16HL:
+				buf = append(buf, byte(s>>8), byte(s))
+			default:
+				buf = append(buf, byte(s), byte(s>>8))
+			}
+		}
+	}
+	return buf
+}
@@ -0,0 +1,486 @@
+// Package shn reads and decodes Shorten (.shn) lossless audio files.
+//
+// A Shorten stream starts with the magic "ajkg", a version byte, and a Rice
+// coded header. The header of the original WAV or AIFF file is stored
+// verbatim at the start of the stream, followed by blocks of predicted and
+// Rice coded samples for each channel in turn.
+package shn
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	defaultBlockSize = 256
+
+	typeSize      = 4
+	chanSize      = 0
+	blockSizeSize = 8 // log2(defaultBlockSize)
+	lpcqSize      = 2
+	nskipSize     = 1
+	fnSize        = 2
+	energySize    = 3
+	bitshiftSize  = 2
+	ulongSize     = 2
+	lpcQuant      = 5
+	nwrap         = 3
+
+	verbatimChunkSize = 5
+	verbatimByteSize  = 8
+
+	maxChannels  = 8
+	maxBlockSize = 65535
+)
+
+// Commands in the stream
+const (
+	fnDiff0 = iota
+	fnDiff1
+	fnDiff2
+	fnDiff3
+	fnQuit
+	fnBlockSize
+	fnBitshift
+	fnQLPC
+	fnZero
+	fnVerbatim
+)
+
+// File types of the original audio
+const (
+	TypeS8    = 1
+	TypeU8    = 2
+	TypeS16HL = 3
+	TypeU16HL = 4
+	TypeS16LH = 5
+	TypeU16LH = 6
+)
+
+var (
+	magic = []byte("ajkg")
+
+	ErrNotShorten = errors.New("not a Shorten stream")
+)
+
+// fixedCoeffs are the predictor coefficients of the fnDiff commands.
+var fixedCoeffs = [][]int32{{}, {1}, {2, -1}, {3, -3, 1}}
+
+// Header describes a Shorten stream and the audio it holds.
+type Header struct {
+	Version   int
+	FileType  int
+	Channels  int
+	BlockSize int
+
+	SampleRate    int
+	BitsPerSample int
+
+	// DataSize is the size in bytes of the audio data according to the
+	// embedded WAV or AIFF header, or 0 if unknown.
+	DataSize int64
+
+	// Verbatim holds the original WAV or AIFF header.
+	Verbatim []byte
+}
+
+// Samples returns the number of samples per channel according to the
+// embedded header, or 0 if unknown.
+func (h *Header) Samples() int64 {
+	frameSize := int64(h.Channels * ((h.BitsPerSample + 7) / 8))
+	if frameSize == 0 {
+		return 0
+	}
+	return h.DataSize / frameSize
+}
+
+// Duration returns the length of the audio according to the embedded header.
+func (h *Header) Duration() time.Duration {
+	if h.SampleRate == 0 {
+		return 0
+	}
+	return time.Duration(h.Samples()) * time.Second / time.Duration(h.SampleRate)
+}
+
+// Decoder decodes the samples of a Shorten stream.
+type Decoder struct {
+	Header Header
+
+	br         *bitReader
+	nmean      int
+	lpcqOffset int32
+	nwrap      int
+	bitshift   uint
+	blockSize  int
+
+	// decoded holds nwrap samples of history followed by the current block
+	// for each channel.
+	decoded [][]int32
+	offset  [][]int32
+	done    bool
+}
+
+// NewDecoder reads the Shorten header and the embedded WAV or AIFF header.
+func NewDecoder(r io.Reader) (*Decoder, error) {
+	start := make([]byte, 5)
+	if _, err := io.ReadFull(r, start); err != nil {
+		return nil, fmt.Errorf("error reading Shorten header: %v", err)
+	}
+	if !bytes.Equal(start[:4], magic) {
+		return nil, ErrNotShorten
+	}
+
+	d := &Decoder{
+		br:        newBitReader(r),
+		blockSize: defaultBlockSize,
+	}
+	d.Header.Version = int(start[4])
+	if d.Header.Version > 3 {
+		return nil, fmt.Errorf("unsupported Shorten version %d", d.Header.Version)
+	}
+
+	if err := d.readHeader(); err != nil {
+		return nil, fmt.Errorf("error reading Shorten header: %v", err)
+	}
+	return d, nil
+}
+
+// ReadHeader reads the header of a Shorten stream without decoding any audio.
+func ReadHeader(r io.Reader) (*Header, error) {
+	d, err := NewDecoder(r)
+	if err != nil {
+		return nil, err
+	}
+	return &d.Header, nil
+}
+
+func (d *Decoder) uint(k uint) (uint32, error) {
+	if d.Header.Version > 0 {
+		n, err := d.br.uvar(ulongSize)
+		if err != nil {
+			return 0, err
+		}
+		if n > 31 {
+			return 0, fmt.Errorf("invalid Rice parameter %d", n)
+		}
+		k = uint(n)
+	}
+	return d.br.uvar(k)
+}
+
+func (d *Decoder) readHeader() error {
+	fileType, err := d.uint(typeSize)
+	if err != nil {
+		return err
+	}
+	channels, err := d.uint(chanSize)
+	if err != nil {
+		return err
+	}
+	if channels == 0 || channels > maxChannels {
+		return fmt.Errorf("invalid channel count %d", channels)
+	}
+	d.Header.FileType = int(fileType)
+	d.Header.Channels = int(channels)
+
+	maxLPC := uint32(0)
+	if d.Header.Version > 0 {
+		blockSize, err := d.uint(blockSizeSize)
+		if err != nil {
+			return err
+		}
+		if blockSize == 0 || blockSize > maxBlockSize {
+			return fmt.Errorf("invalid block size %d", blockSize)
+		}
+		d.blockSize = int(blockSize)
+
+		if maxLPC, err = d.uint(lpcqSize); err != nil {
+			return err
+		}
+		if maxLPC > 1024 {
+			return fmt.Errorf("invalid maximum LPC order %d", maxLPC)
+		}
+		nmean, err := d.uint(0)
+		if err != nil {
+			return err
+		}
+		if nmean > 32768 {
+			return fmt.Errorf("invalid mean count %d", nmean)
+		}
+		d.nmean = int(nmean)
+
+		skip, err := d.uint(nskipSize)
+		if err != nil {
+			return err
+		}
+		for range skip {
+			if _, err := d.br.bits(8); err != nil {
+				return err
+			}
+		}
+	}
+	d.Header.BlockSize = d.blockSize
+	d.nwrap = max(nwrap, int(maxLPC))
+	if d.Header.Version > 1 {
+		d.lpcqOffset = 1 << lpcQuant
+	}
+
+	mean := int32(0)
+	switch d.Header.FileType {
+	case TypeU8:
+		mean = 0x80
+	case TypeS8, TypeS16HL, TypeS16LH:
+	default:
+		return fmt.Errorf("unsupported audio type %d", d.Header.FileType)
+	}
+
+	d.decoded = make([][]int32, d.Header.Channels)
+	d.offset = make([][]int32, d.Header.Channels)
+	for ch := range d.decoded {
+		d.decoded[ch] = make([]int32, d.nwrap+d.blockSize)
+		d.offset[ch] = make([]int32, max(1, d.nmean))
+		for i := range d.offset[ch] {
+			d.offset[ch][i] = mean
+		}
+	}
+
+	// The original file header must be stored verbatim at the start
+	cmd, err := d.br.uvar(fnSize)
+	if err != nil {
+		return err
+	}
+	if cmd != fnVerbatim {
+		return errors.New("missing verbatim header at start of stream")
+	}
+	if d.Header.Verbatim, err = d.readVerbatim(); err != nil {
+		return err
+	}
+
+	d.parseVerbatim()
+	return nil
+}
+
+func (d *Decoder) readVerbatim() ([]byte, error) {
+	size, err := d.br.uvar(verbatimChunkSize)
+	if err != nil {
+		return nil, err
+	}
+	if size > 1<<20 {
+		return nil, fmt.Errorf("invalid verbatim chunk size %d", size)
+	}
+
+	chunk := make([]byte, size)
+	for i := range chunk {
+		b, err := d.br.uvar(verbatimByteSize)
+		if err != nil {
+			return nil, err
+		}
+		chunk[i] = byte(b)
+	}
+	return chunk, nil
+}
+
+// Next decodes the next block of samples. It returns one slice of samples per
+// channel, which are only valid until the next call, or io.EOF at the end of
+// the stream.
+func (d *Decoder) Next() ([][]int32, error) {
+	if d.done {
+		return nil, io.EOF
+	}
+
+	ch := 0
+	for {
+		cmd, err := d.br.uvar(fnSize)
+		if err != nil {
+			return nil, err
+		}
+
+		switch cmd {
+		case fnQuit:
+			d.done = true
+			return nil, io.EOF
+
+		case fnBlockSize:
+			size, err := d.uint(blockSizeSize)
+			if err != nil {
+				return nil, err
+			}
+			if size == 0 || size > maxBlockSize {
+				return nil, fmt.Errorf("invalid block size %d", size)
+			}
+			d.resize(int(size))
+
+		case fnBitshift:
+			shift, err := d.br.uvar(bitshiftSize)
+			if err != nil {
+				return nil, err
+			}
+			if shift > 31 {
+				return nil, fmt.Errorf("invalid bit shift %d", shift)
+			}
+			d.bitshift = uint(shift)
+
+		case fnVerbatim:
+			// Trailing chunks of the original file, such as a WAV footer
+			if _, err := d.readVerbatim(); err != nil {
+				return nil, err
+			}
+
+		case fnDiff0, fnDiff1, fnDiff2, fnDiff3, fnQLPC, fnZero:
+			if err := d.decodeBlock(ch, cmd); err != nil {
+				return nil, err
+			}
+			ch++
+			if ch == d.Header.Channels {
+				block := make([][]int32, d.Header.Channels)
+				for i := range block {
+					block[i] = d.decoded[i][d.nwrap:]
+				}
+				return block, nil
+			}
+
+		default:
+			return nil, fmt.Errorf("invalid command %d", cmd)
+		}
+	}
+}
+
+func (d *Decoder) resize(blockSize int) {
+	for ch := range d.decoded {
+		buf := make([]int32, d.nwrap+blockSize)
+		copy(buf, d.decoded[ch][:d.nwrap])
+		d.decoded[ch] = buf
+	}
+	d.blockSize = blockSize
+}
+
+func (d *Decoder) decodeBlock(ch int, cmd uint32) error {
+	buf := d.decoded[ch]
+	samples := buf[d.nwrap:]
+
+	residualSize := uint(0)
+	if cmd != fnZero {
+		size, err := d.br.uvar(energySize)
+		if err != nil {
+			return err
+		}
+		// Version 0 differed in the definition of signed Rice codes
+		if d.Header.Version == 0 {
+			if size == 0 {
+				return fmt.Errorf("invalid residual size %d", size)
+			}
+			size--
+		}
+		if size > 31 {
+			return fmt.Errorf("invalid residual size %d", size)
+		}
+		residualSize = uint(size)
+	}
+
+	// Mean of previous blocks
+	var coffset int32
+	if d.nmean == 0 {
+		coffset = d.offset[ch][0]
+	} else {
+		sum := int32(0)
+		if d.Header.Version >= 2 {
+			sum = int32(d.nmean / 2)
+		}
+		for _, o := range d.offset[ch][:d.nmean] {
+			sum += o
+		}
+		coffset = sum / int32(d.nmean)
+		if d.Header.Version >= 2 && d.bitshift > 0 {
+			coffset >>= d.bitshift
+		}
+	}
+
+	if cmd == fnZero {
+		clear(samples)
+	} else {
+		var coeffs []int32
+		qshift := uint(0)
+		if cmd == fnQLPC {
+			order, err := d.br.uvar(lpcqSize)
+			if err != nil {
+				return err
+			}
+			if int(order) > d.nwrap {
+				return fmt.Errorf("invalid LPC order %d", order)
+			}
+			coeffs = make([]int32, order)
+			for i := range coeffs {
+				if coeffs[i], err = d.br.svar(lpcQuant); err != nil {
+					return err
+				}
+			}
+			qshift = lpcQuant
+
+			// Predict from history with the mean removed
+			if coffset != 0 {
+				for i := d.nwrap - len(coeffs); i < d.nwrap; i++ {
+					buf[i] -= coffset
+				}
+			}
+		} else {
+			coeffs = fixedCoeffs[cmd]
+		}
+
+		initSum := coffset
+		if len(coeffs) > 0 {
+			initSum = 0
+			if cmd == fnQLPC {
+				initSum = d.lpcqOffset
+			}
+		}
+
+		for i := d.nwrap; i < len(buf); i++ {
+			sum := initSum
+			for j, c := range coeffs {
+				sum += c * buf[i-j-1]
+			}
+			residual, err := d.br.svar(residualSize)
+			if err != nil {
+				return err
+			}
+			buf[i] = residual + sum>>qshift
+		}
+
+		if cmd == fnQLPC && coffset != 0 {
+			for i := range samples {
+				samples[i] += coffset
+			}
+		}
+	}
+
+	// Update the means with the current block
+	if d.nmean > 0 {
+		sum := int64(0)
+		if d.Header.Version >= 2 {
+			sum = int64(d.blockSize / 2)
+		}
+		for _, s := range samples {
+			sum += int64(s)
+		}
+		copy(d.offset[ch], d.offset[ch][1:])
+		mean := int32(sum / int64(d.blockSize))
+		if d.Header.Version >= 2 {
+			mean <<= d.bitshift
+		}
+		d.offset[ch][d.nmean-1] = mean
+	}
+
+	// Keep history for the next block
+	copy(buf[:d.nwrap], buf[len(buf)-d.nwrap:])
+
+	if d.bitshift > 0 {
+		for i := range samples {
+			samples[i] <<= d.bitshift
+		}
+	}
+
+	return nil
+}
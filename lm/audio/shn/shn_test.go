@@ -0,0 +1,174 @@
+package shn
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math/bits"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// bitWriter writes the most significant bit first bit streams that
+// bitReader reads.
+type bitWriter struct {
+	buf []byte
+	n   uint
+}
+
+func (w *bitWriter) bits(v uint32, n uint) {
+	for i := n; i > 0; i-- {
+		if w.n%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>(i-1)&1 != 0 {
+			w.buf[len(w.buf)-1] |= 0x80 >> (w.n % 8)
+		}
+		w.n++
+	}
+}
+
+func (w *bitWriter) uvar(v uint32, k uint) {
+	for range v >> k {
+		w.bits(0, 1)
+	}
+	w.bits(1, 1)
+	w.bits(v, k)
+}
+
+func (w *bitWriter) svar(v int32, k uint) {
+	u := uint32(v) << 1
+	if v < 0 {
+		u = uint32(^v)<<1 | 1
+	}
+	w.uvar(u, k+1)
+}
+
+// uint writes a header value the way versions 1 and later store them.
+func (w *bitWriter) uint(v uint32) {
+	k := uint32(bits.Len32(v))
+	w.uvar(k, ulongSize)
+	w.uvar(v, uint(k))
+}
+
+// wavHeader returns the header of a mono 16 bit, 44.1 kHz WAV file.
+func wavHeader(dataSize int) []byte {
+	h := []byte("RIFF\x00\x00\x00\x00WAVEfmt \x10\x00\x00\x00")
+	h = binary.LittleEndian.AppendUint16(h, 1)
+	h = binary.LittleEndian.AppendUint16(h, 1)
+	h = binary.LittleEndian.AppendUint32(h, 44100)
+	h = binary.LittleEndian.AppendUint32(h, 88200)
+	h = binary.LittleEndian.AppendUint16(h, 2)
+	h = binary.LittleEndian.AppendUint16(h, 16)
+	h = append(h, "data"...)
+	h = binary.LittleEndian.AppendUint32(h, uint32(dataSize))
+	binary.LittleEndian.PutUint32(h[4:], uint32(len(h)-8+dataSize))
+	return h
+}
+
+func (w *bitWriter) verbatim(b []byte) {
+	w.uvar(fnVerbatim, fnSize)
+	w.uvar(uint32(len(b)), verbatimChunkSize)
+	for _, c := range b {
+		w.uvar(uint32(c), verbatimByteSize)
+	}
+}
+
+// stream returns a version 2 stream of one block of mono 16 bit samples.
+func stream(samples []int32) []byte {
+	w := &bitWriter{}
+	w.uint(TypeS16LH)
+	w.uint(1)
+	w.uint(uint32(len(samples)))
+	w.uint(0) // maximum LPC order
+	w.uint(0) // mean count
+	w.uint(0) // skipped bytes
+	w.verbatim(wavHeader(len(samples) * 2))
+
+	// First order prediction from the previous sample
+	w.uvar(fnDiff1, fnSize)
+	w.uvar(4, energySize)
+	prev := int32(0)
+	for _, s := range samples {
+		w.svar(s-prev, 4)
+		prev = s
+	}
+	w.uvar(fnQuit, fnSize)
+	return append([]byte("ajkg\x02"), w.buf...)
+}
+
+func TestReadHeader(t *testing.T) {
+	h, err := ReadHeader(bytes.NewReader(stream([]int32{1, 3, 2, -1})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Version != 2 || h.FileType != TypeS16LH || h.Channels != 1 || h.BlockSize != 4 {
+		t.Errorf("ReadHeader() = %+v", h)
+	}
+	if h.SampleRate != 44100 || h.BitsPerSample != 16 || h.Samples() != 4 {
+		t.Errorf("SampleRate, BitsPerSample, Samples() = %d, %d, %d, want 44100, 16, 4", h.SampleRate, h.BitsPerSample, h.Samples())
+	}
+}
+
+func TestDecode(t *testing.T) {
+	samples := []int32{1, 3, 2, -1, 300, -300}
+	d, err := NewDecoder(bytes.NewReader(stream(samples)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := d.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]int32{samples}; !reflect.DeepEqual(block, want) {
+		t.Errorf("Next() = %v, want %v", block, want)
+	}
+	if _, err := d.Next(); err != io.EOF {
+		t.Errorf("Next() at the end = %v, want io.EOF", err)
+	}
+}
+
+func TestAudioMD5(t *testing.T) {
+	samples := []int32{1, 3, 2, -1}
+	pcm := []byte{}
+	for _, s := range samples {
+		pcm = binary.LittleEndian.AppendUint16(pcm, uint16(s))
+	}
+	sum := md5.Sum(pcm)
+
+	got, n, err := AudioMD5(bytes.NewReader(stream(samples)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := hex.EncodeToString(sum[:]); got != want || n != 4 {
+		t.Errorf("AudioMD5() = %s, %d, want %s, 4", got, n, want)
+	}
+}
+
+func TestNotShorten(t *testing.T) {
+	if _, err := ReadHeader(strings.NewReader("fLaC\x00")); !errors.Is(err, ErrNotShorten) {
+		t.Errorf("ReadHeader() error = %v, want %v", err, ErrNotShorten)
+	}
+}
+
+func TestVersion0ResidualSize(t *testing.T) {
+	// Version 0 stores residual sizes one higher, so 0 is invalid
+	w := &bitWriter{}
+	w.uvar(TypeS16LH, typeSize)
+	w.uvar(1, chanSize)
+	w.verbatim(wavHeader(0))
+	w.uvar(fnDiff0, fnSize)
+	w.uvar(0, energySize)
+
+	d, err := NewDecoder(bytes.NewReader(append([]byte("ajkg\x00"), w.buf...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Next(); err == nil || !strings.Contains(err.Error(), "invalid residual size") {
+		t.Errorf("Next() error = %v, want an invalid residual size", err)
+	}
+}
@@ -0,0 +1,176 @@
+// Package wav reads the format, audio data location, and tags of WAV files.
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	chunkHeaderSize = 8
+
+	formatExtensible = 0xfffe
+
+	// rf64Size is stored in place of sizes that are in the ds64 chunk of
+	// RF64 files, which can be larger than 4GB.
+	rf64Size = 0xffffffff
+)
+
+var (
+	ErrNotWAV = errors.New("not a WAV file")
+
+	// infoNames maps the RIFF INFO chunk ids to tag names
+	infoNames = map[string]string{
+		"IART": "artist",
+		"ICMT": "comment",
+		"ICRD": "date",
+		"IGNR": "genre",
+		"INAM": "title",
+		"IPRD": "album",
+		"IPRT": "tracknumber",
+		"ITRK": "tracknumber",
+	}
+)
+
+// Chunk is the location of a chunk's data within a file.
+type Chunk struct {
+	Offset int64
+	Size   int64
+}
+
+// File describes a WAV file.
+type File struct {
+	// Format is the WAVE format tag, such as 1 for PCM, with the sub-format
+	// of extensible files.
+	Format        int
+	BitsPerSample int
+	Channels      int
+	SampleRate    int
+	Samples       int64
+	Duration      time.Duration
+
+	// Data is the audio, and ID3 is the ID3v2 tag, if any.
+	Data Chunk
+	ID3  *Chunk
+	// Info holds the RIFF INFO tags, using Vorbis comment style names.
+	Info map[string]string
+}
+
+// Read reads the chunks of a WAV file.
+func Read(rs io.ReadSeeker) (*File, error) {
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(rs, header); err != nil {
+		return nil, fmt.Errorf("error reading WAV header: %v", err)
+	}
+	riff := string(header[0:4])
+	if (riff != "RIFF" && riff != "RF64") || string(header[8:12]) != "WAVE" {
+		return nil, ErrNotWAV
+	}
+
+	f := &File{Info: map[string]string{}}
+	offset := int64(len(header))
+	dataSize := int64(-1)
+	blockAlign := 0
+	for {
+		chunk := make([]byte, chunkHeaderSize)
+		if _, err := io.ReadFull(rs, chunk); err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("error reading WAV chunk: %v", err)
+		}
+		id := string(chunk[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		offset += chunkHeaderSize
+
+		switch id {
+		case "ds64":
+			b, err := readChunk(rs, size, 24)
+			if err != nil {
+				return nil, err
+			}
+			dataSize = int64(binary.LittleEndian.Uint64(b[8:16]))
+		case "fmt ":
+			b, err := readChunk(rs, size, 16)
+			if err != nil {
+				return nil, err
+			}
+			f.Format = int(binary.LittleEndian.Uint16(b[0:2]))
+			f.Channels = int(binary.LittleEndian.Uint16(b[2:4]))
+			f.SampleRate = int(binary.LittleEndian.Uint32(b[4:8]))
+			blockAlign = int(binary.LittleEndian.Uint16(b[12:14]))
+			f.BitsPerSample = int(binary.LittleEndian.Uint16(b[14:16]))
+			if f.Format == formatExtensible && len(b) >= 26 {
+				// The sub-format GUID starts with the format tag
+				f.Format = int(binary.LittleEndian.Uint16(b[24:26]))
+			}
+		case "data":
+			if riff == "RF64" && size == rf64Size && dataSize >= 0 {
+				size = dataSize
+			}
+			f.Data = Chunk{Offset: offset, Size: size}
+		case "id3 ", "ID3 ":
+			f.ID3 = &Chunk{Offset: offset, Size: size}
+		case "LIST":
+			b, err := readChunk(rs, size, 4)
+			if err != nil {
+				return nil, err
+			}
+			if string(b[0:4]) == "INFO" {
+				readInfo(f.Info, b[4:])
+			}
+		}
+
+		// Chunks are padded to an even size
+		offset += size + size&1
+		if _, err := rs.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	if f.Data.Offset == 0 {
+		return nil, fmt.Errorf("no data chunk found")
+	}
+	if blockAlign > 0 {
+		f.Samples = f.Data.Size / int64(blockAlign)
+	}
+	if f.SampleRate > 0 {
+		f.Duration = time.Duration(f.Samples) * time.Second / time.Duration(f.SampleRate)
+	}
+	return f, nil
+}
+
+// readChunk reads the data of a chunk, which must be at least minSize bytes.
+func readChunk(r io.Reader, size, minSize int64) ([]byte, error) {
+	if size < minSize {
+		return nil, fmt.Errorf("invalid WAV chunk size %d", size)
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, fmt.Errorf("error reading WAV chunk: %v", err)
+	}
+	return b, nil
+}
+
+func readInfo(info map[string]string, b []byte) {
+	for len(b) >= chunkHeaderSize {
+		id := string(b[0:4])
+		size := int(binary.LittleEndian.Uint32(b[4:8]))
+		b = b[chunkHeaderSize:]
+		if size > len(b) {
+			return
+		}
+		if name, ok := infoNames[id]; ok {
+			value, _, _ := bytes.Cut(b[:size], []byte{0})
+			info[name] = strings.TrimSpace(string(value))
+		}
+		b = b[min(size+size&1, len(b)):]
+	}
+}
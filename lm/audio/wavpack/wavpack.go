@@ -0,0 +1,148 @@
+// Package wavpack reads the properties of WavPack streams from their first
+// block.
+package wavpack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	headerSize = 32
+
+	flagBytesPerSample = 0x3
+	flagMono           = 0x4
+	flagHybrid         = 0x8
+	flagShiftMask      = 0x1f << 13
+	flagShiftOffset    = 13
+	flagRateMask       = 0xf << 23
+	flagRateOffset     = 23
+	flagDSD            = 0x80000000
+
+	// Metadata sub-block ids
+	idLargeSize   = 0x80
+	idOddSize     = 0x40
+	idFunction    = 0x3f
+	idChannelInfo = 0xd
+	idSampleRate  = 0x27
+
+	// unknownSamples is stored when the encoder didn't know the length
+	unknownSamples = 0xffffffff
+)
+
+var (
+	Magic = []byte("wvpk")
+
+	ErrNotWavPack = errors.New("not a WavPack stream")
+
+	sampleRates = [15]int{6000, 8000, 9600, 11025, 12000, 16000, 22050, 24000, 32000, 44100, 48000, 64000, 88200, 96000, 192000}
+)
+
+// Properties describes a WavPack stream.
+type Properties struct {
+	Version       int
+	BitsPerSample int
+	Channels      int
+	SampleRate    int
+	Samples       int64
+	Duration      time.Duration
+	// Lossless is false for hybrid streams, whose correction data is kept
+	// in a separate .wvc file.
+	Lossless bool
+	DSD      bool
+}
+
+// ReadProperties reads the first block of a WavPack stream.
+func ReadProperties(r io.Reader) (*Properties, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("error reading WavPack header: %v", err)
+	}
+	if !bytes.Equal(header[:4], Magic) {
+		return nil, ErrNotWavPack
+	}
+
+	// The block size excludes the magic and size fields
+	blockSize := int64(binary.LittleEndian.Uint32(header[4:8])) + 8
+	totalSamples := int64(binary.LittleEndian.Uint32(header[12:16]))
+	flags := binary.LittleEndian.Uint32(header[24:28])
+
+	p := &Properties{
+		Version:       int(binary.LittleEndian.Uint16(header[8:10])),
+		BitsPerSample: int(flags&flagBytesPerSample+1)*8 - int(flags&flagShiftMask>>flagShiftOffset),
+		Channels:      2,
+		Lossless:      flags&flagHybrid == 0,
+		DSD:           flags&flagDSD != 0,
+	}
+	if flags&flagMono != 0 {
+		p.Channels = 1
+	}
+	if rate := flags & flagRateMask >> flagRateOffset; int(rate) < len(sampleRates) {
+		p.SampleRate = sampleRates[rate]
+	}
+	if totalSamples != unknownSamples {
+		// Version 5 extends the sample count with upper bits stored in
+		// place of the index number, each of which counts 2^32 - 1 samples
+		upper := int64(header[11])
+		p.Samples = totalSamples + upper<<32 - upper
+	}
+
+	if blockSize > headerSize {
+		body := make([]byte, blockSize-headerSize)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return nil, fmt.Errorf("error reading WavPack block: %v", err)
+		}
+		p.readSubBlocks(body)
+	}
+
+	if p.DSD {
+		// DSD audio is stored as bytes of 8 one bit samples
+		p.BitsPerSample = 1
+		p.SampleRate *= 8
+		p.Samples *= 8
+	}
+	if p.SampleRate > 0 {
+		p.Duration = time.Duration(p.Samples) * time.Second / time.Duration(p.SampleRate)
+	}
+	return p, nil
+}
+
+// readSubBlocks fills in the channel count and custom sample rate from the
+// metadata sub-blocks of a block.
+func (p *Properties) readSubBlocks(b []byte) {
+	for len(b) >= 2 {
+		id := b[0]
+		size := int(b[1]) * 2
+		b = b[2:]
+		if id&idLargeSize != 0 {
+			if len(b) < 2 {
+				return
+			}
+			size += int(b[0])<<9 | int(b[1])<<17
+			b = b[2:]
+		}
+		if size > len(b) {
+			return
+		}
+		data := b[:size]
+		if id&idOddSize != 0 && size > 0 {
+			data = data[:size-1]
+		}
+
+		switch id & idFunction {
+		case idChannelInfo:
+			if len(data) > 0 {
+				p.Channels = int(data[0])
+			}
+		case idSampleRate:
+			if len(data) >= 3 {
+				p.SampleRate = int(data[0]) | int(data[1])<<8 | int(data[2])<<16
+			}
+		}
+		b = b[size:]
+	}
+}
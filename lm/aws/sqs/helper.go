@@ -3,9 +3,52 @@ package sqs
 import (
 	"fmt"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sqs"
 )
 
+// DefaultRegion is the AWS region used when none is configured.
+const DefaultRegion = "us-west-2"
+
+// Settings describe how to connect to SQS.
+type Settings struct {
+	// Profile is the AWS shared config profile, or "" for the default one.
+	Profile string
+	Region  string
+	// Endpoint overrides the SQS endpoint, for SQS compatible servers such
+	// as ElasticMQ or LocalStack.
+	Endpoint string
+}
+
+// NewSession creates an AWS session and checks that its credentials load.
+func NewSession(s Settings) (*session.Session, error) {
+	options := session.Options{
+		// Provide SDK Config options, such as Region.
+		Config: aws.Config{
+			Region: aws.String(s.Region),
+		},
+		// Force enable Shared Config support
+		SharedConfigState: session.SharedConfigEnable,
+	}
+	if s.Endpoint != "" {
+		options.Config.Endpoint = aws.String(s.Endpoint)
+	}
+	if s.Profile != "" {
+		// Specify profile to load for the session's config
+		options.Profile = s.Profile
+	}
+
+	sess, err := session.NewSessionWithOptions(options)
+	if err != nil {
+		return nil, fmt.Errorf("error creating AWS session: %v", err)
+	}
+	if _, err = sess.Config.Credentials.Get(); err != nil {
+		return nil, fmt.Errorf("error loading AWS credentials: %v", err)
+	}
+	return sess, nil
+}
+
 // GetQueueURL retrieves the SQS Queue URL for a given queue name.
 func GetQueueURL(sqsSvc *sqs.SQS, queueName string) (string, error) {
 	url, err := sqsSvc.GetQueueUrl(&sqs.GetQueueUrlInput{
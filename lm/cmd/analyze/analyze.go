@@ -3,15 +3,25 @@ package analyze
 import (
 	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/dhowden/tag"
+	"github.com/organicveggie/livemusic/lm/archive"
+	"github.com/organicveggie/livemusic/lm/audio/formats"
+	sqsh "github.com/organicveggie/livemusic/lm/aws/sqs"
+	"github.com/organicveggie/livemusic/lm/cmd/db"
+	"github.com/organicveggie/livemusic/lm/etree"
+	"github.com/organicveggie/livemusic/lm/library"
+	"github.com/organicveggie/livemusic/lm/message"
+	"github.com/organicveggie/livemusic/lm/storage"
 	"github.com/spf13/cobra"
 	"golang.org/x/sync/errgroup"
 )
@@ -20,9 +30,27 @@ type commandConfig struct {
 	source     Source
 	sourceFile string
 
-	awsProfile string
-	mongoURI   string
-	queueName  string
+	artistTable       string
+	awsProfile        string
+	deadLetterQueue   string
+	dryRun            bool
+	failuresReport    string
+	force             bool
+	formats           []string
+	libraryRoots      []string
+	maxReceives       int
+	migrateIds        bool
+	mongoURI          string
+	output            outputFormat
+	outputFile        string
+	queueName         string
+	recordFailures    bool
+	region            string
+	retryDelay        time.Duration
+	skipFormats       []string
+	sqsEndpoint       string
+	visibilityTimeout time.Duration
+	workers           int
 }
 
 var (
@@ -38,9 +66,13 @@ var (
 )
 
 func checkFlags(cfg *commandConfig) error {
+	if cfg.dryRun {
+		cfg.output = outputJSONL
+	}
+
 	cfg.mongoURI = cmp.Or(cfg.mongoURI, os.Getenv("MONGODB_URI"))
-	if cfg.mongoURI == "" {
-		return fmt.Errorf("missing required MongoDB connection string")
+	if cfg.output == outputStorage && cfg.mongoURI == "" {
+		return fmt.Errorf("missing required storage connection string")
 	}
 
 	if cfg.source == SourceFile && cfg.sourceFile == "" {
@@ -49,14 +81,49 @@ func checkFlags(cfg *commandConfig) error {
 	if cfg.source == SourceSQS && cfg.queueName == "" {
 		return fmt.Errorf("missing required --queue_name flag")
 	}
+	if cfg.source == SourceMongo && (cfg.mongoURI == "" || strings.HasPrefix(cfg.mongoURI, "sqlite://")) {
+		return fmt.Errorf("the mongo source requires a MongoDB connection string")
+	}
+	queued := cfg.source == SourceSQS || cfg.source == SourceMongo
+	if queued && cfg.maxReceives < 1 {
+		return fmt.Errorf("--max_receives must be at least 1")
+	}
+	if queued && cfg.visibilityTimeout < 2*time.Second {
+		return fmt.Errorf("--visibility_timeout must be at least 2s")
+	}
+	if queued && cfg.retryDelay < 0 {
+		return fmt.Errorf("--retry_delay must not be negative")
+	}
+	if cfg.workers < 1 {
+		return fmt.Errorf("--workers must be at least 1")
+	}
 
 	return nil
 }
 
 func init() {
+	Cmd.Flags().StringVar(&cfg.artistTable, "artist_table", "", "File of abbr=Artist Name lines to extend the etree artist abbreviations")
 	Cmd.Flags().StringVarP(&cfg.awsProfile, "aws_profile", "a", "", "Name of the AWS profile to use")
-	Cmd.Flags().StringVarP(&cfg.mongoURI, "mongodb_uri", "m", "", "MongoDB connection string")
-	Cmd.Flags().StringVarP(&cfg.queueName, "queue_name", "q", "live-music", "Name of destination queue")
+	Cmd.Flags().StringVar(&cfg.region, "region", sqsh.DefaultRegion, "AWS region of the SQS queue")
+	Cmd.Flags().StringVar(&cfg.sqsEndpoint, "sqs_endpoint", "", "Custom SQS endpoint, such as an ElasticMQ or LocalStack server")
+	Cmd.Flags().StringVar(&cfg.deadLetterQueue, "dead_letter_queue", "", "Name of the queue that SQS messages are moved to once they fail --max_receives times, rather than deleted")
+	Cmd.Flags().BoolVar(&cfg.dryRun, "dry_run", false, "Same as --output jsonl, which leaves queue messages on the queue")
+	Cmd.Flags().StringVar(&cfg.failuresReport, "failures_report", "", "JSONL file to write the files which couldn't be analyzed to, if any")
+	Cmd.Flags().StringSliceVar(&cfg.formats, "formats", nil, fmt.Sprintf("Audio formats to analyze, or all of them if empty: %s", strings.Join(formats.Names(), ",")))
+	Cmd.Flags().StringSliceVar(&cfg.skipFormats, "skip_formats", nil, "Audio formats not to analyze")
+	Cmd.Flags().BoolVar(&cfg.force, "force", false, "Re-analyze files even if their size and modification time are unchanged")
+	Cmd.Flags().StringSliceVarP(&cfg.libraryRoots, "library_root", "l", nil, "Library root folders that track paths are stored relative to")
+	Cmd.Flags().IntVar(&cfg.maxReceives, "max_receives", 5, "Number of times a queue message is received before it is dead-lettered or marked failed")
+	Cmd.Flags().BoolVar(&cfg.migrateIds, "migrate_ids", false, "Apply pending database migrations, such as moving tracks to path and content hash identifiers, before analyzing")
+	Cmd.Flags().StringVarP(&cfg.mongoURI, "mongodb_uri", "m", "", "MongoDB connection string, or sqlite:///path/lm.db for a local SQLite database")
+	Cmd.Flags().DurationVar(&cfg.retryDelay, "retry_delay", 30*time.Second, "How much longer a failed queue message waits before it's retried after each attempt")
+	Cmd.Flags().BoolVar(&cfg.recordFailures, "record_failures", false, "Save files which couldn't be analyzed to the failures collection")
+	cfg.output = outputStorage
+	Cmd.Flags().Var(&cfg.output, "output", `Where results go: "storage" saves them, "jsonl" writes tracks as JSON Lines to --output_file`)
+	Cmd.Flags().StringVar(&cfg.outputFile, "output_file", "-", `File that --output jsonl writes to, or "-" for stdout`)
+	Cmd.Flags().StringVarP(&cfg.queueName, "queue_name", "q", "live-music", "Name of the SQS or MongoDB queue to analyze files from")
+	Cmd.Flags().DurationVar(&cfg.visibilityTimeout, "visibility_timeout", time.Minute, "How long queue messages stay hidden from other consumers, extended while a file is analyzed")
+	Cmd.Flags().IntVarP(&cfg.workers, "workers", "w", runtime.NumCPU(), "Number of files to analyze concurrently")
 	Cmd.Flags().VarP(&cfg.source, "source", "s", fmt.Sprintf("Source of files to analyze: %s", strings.Join(sourceNames(), ",")))
 	Cmd.Flags().StringVarP(&cfg.sourceFile, "file", "f", "", "Filename containing a list of files to analyze")
 }
@@ -66,7 +133,34 @@ type SourceHandler interface {
 	Close() error
 }
 
-type AnalyzeChan chan<- string
+// job is a file to analyze. Sources that need to know the outcome, such as
+// queues that acknowledge messages, set done, which is called once the file
+// has been analyzed.
+type job struct {
+	filename string
+	// libraryRoot is the library root the scan found the file in, used when
+	// none of the --library_root folders contain it.
+	libraryRoot string
+	// removed is set for files that a scan found were removed.
+	removed bool
+	done    func(err error)
+}
+
+// newJob builds a job from a scan message, which is either a JSON envelope or
+// a bare path.
+func newJob(body string) (job, error) {
+	f, err := message.Decode(body)
+	if err != nil {
+		return job{}, err
+	}
+	return job{
+		filename:    f.Path,
+		libraryRoot: f.LibraryRoot,
+		removed:     f.Event == message.EventRemoved,
+	}, nil
+}
+
+type AnalyzeChan chan<- job
 
 func analyze(cmd *cobra.Command, args []string) error {
 	if err := checkFlags(&cfg); err != nil {
@@ -75,101 +169,145 @@ func analyze(cmd *cobra.Command, args []string) error {
 
 	ctx := cmp.Or(cmd.Context(), context.Background())
 
-	fmt.Println("Setting up MongoDB connection...")
-	storage, err := newStorageHandler(cfg.mongoURI)
+	audio, err := formats.New(cfg.formats, cfg.skipFormats)
 	if err != nil {
-		return fmt.Errorf("error loading storage handler for %q: %v", cfg.mongoURI, err)
+		return err
+	}
+
+	var store storage.Handler
+	if cfg.output == outputJSONL {
+		if cfg.outputFile == "-" {
+			logOut = os.Stderr
+		}
+		if store, err = storage.NewJSONL(cfg.outputFile); err != nil {
+			return err
+		}
+	} else {
+		logf("Setting up storage...\n")
+		if store, err = storage.Open(cfg.mongoURI); err != nil {
+			return fmt.Errorf("error loading storage handler for %q: %v", cfg.mongoURI, err)
+		}
 	}
 	defer func() error {
-		if err := storage.Close(ctx); err != nil {
-			return fmt.Errorf("error disconnecting from MongoDB: %v", err)
+		if err := store.Close(ctx); err != nil {
+			return fmt.Errorf("error closing storage: %v", err)
 		}
 		return nil
 	}()
 
-	ch := make(chan string)
+	artists := etree.DefaultArtists()
+	if cfg.artistTable != "" {
+		if artists, err = etree.LoadArtistTable(cfg.artistTable); err != nil {
+			return err
+		}
+	}
+	names := etree.NewParser(artists)
 
-	for _, f := range args {
-		analyzeFile(storage, f)
+	lib := library.New(cfg.libraryRoots)
+	if cfg.migrateIds && cfg.output == outputStorage {
+		if err := db.Migrate(ctx, store, &db.Options{Library: lib, Audio: audio}); err != nil {
+			return err
+		}
 	}
+	a := newAnalyzer(store, names, audio, lib, cfg.force, cfg.recordFailures)
+
+	ch := make(chan job)
 
 	var handler SourceHandler
 	if cfg.source == SourceFile {
-		fmt.Println("Setting up file source...")
+		logf("Setting up file source...\n")
 		handler, err = newFileSourceHandler(ch, cfg.sourceFile)
 		if err != nil {
 			return fmt.Errorf("error creating file source %s: %v", cfg.sourceFile, err)
 		}
 	} else if cfg.source == SourceSQS {
-		fmt.Println("Setting up SQS source...")
-		handler, err = newSQSSource(ch, cfg.awsProfile, cfg.queueName)
+		logf("Setting up SQS source...\n")
+		handler, err = newSQSSource(ch, sqsh.Settings{Profile: cfg.awsProfile, Region: cfg.region, Endpoint: cfg.sqsEndpoint}, cfg.queueName, queueOptions{
+			deadLetterQueue:   cfg.deadLetterQueue,
+			maxReceives:       cfg.maxReceives,
+			retryDelay:        cfg.retryDelay,
+			visibilityTimeout: cfg.visibilityTimeout,
+			keep:              cfg.output == outputJSONL,
+		})
 		if err != nil {
 			return fmt.Errorf("error creating SQS source for %s: %v", cfg.queueName, err)
 		}
+	} else if cfg.source == SourceMongo {
+		logf("Setting up MongoDB queue source...\n")
+		handler, err = newMongoQueueSource(ch, cfg.mongoURI, cfg.queueName, queueOptions{
+			maxReceives:       cfg.maxReceives,
+			retryDelay:        cfg.retryDelay,
+			visibilityTimeout: cfg.visibilityTimeout,
+			keep:              cfg.output == outputJSONL,
+		})
+		if err != nil {
+			return fmt.Errorf("error creating MongoDB queue source for %s: %v", cfg.queueName, err)
+		}
+	}
+	if handler != nil {
+		defer handler.Close()
 	}
-	defer handler.Close()
 
-	errs, ctx := errgroup.WithContext(ctx)
+	errs := errgroup.Group{}
 	errs.Go(func() error {
-		fmt.Println("Retrieving files...")
 		defer close(ch)
+		for _, f := range args {
+			ch <- job{filename: f}
+		}
+		if handler == nil {
+			return nil
+		}
+		logf("Retrieving files...\n")
 		return handler.Analyze()
 	})
 
-	for filename := range ch {
-		analyzeFile(storage, filename)
+	// The channel is unbuffered, so at most one file per worker is in flight
+	// and sources wait for a free worker before reading more.
+	var wg sync.WaitGroup
+	for range cfg.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range ch {
+				err := a.process(j)
+				if j.done != nil {
+					j.done(err)
+				}
+			}
+		}()
 	}
+	wg.Wait()
 
-	return errs.Wait()
-}
-
-type Metadata struct {
-	Id       string    `json:"id" bson:"_id"`
-	Filename string    `json:"filename" bson:"filename"`
-	Album    string    `json:"album" bson:"album"`
-	Artist   string    `json:"artist" bson:"artist"`
-	Date     time.Time `json:"date" bson:"date,omitempty"`
-	Disc     int       `json:"disc" bson:"disc,omitempty"`
-	Genre    []string  `json:"genre" bson:"genre,omitempty"`
-	Set      int       `json:"set" bson:"set,omitempty"`
-	Title    string    `json:"title" bson:"title"`
-	Track    int       `json:"track" bson:"track,omitempty"`
-	Venue    string    `json:"venue" bson:"venue,omitempty"`
-
-	AccousticIdFingerprint string      `json:"accoustic_id_fingerprint" bson:"accoustic_id_fingerprint,omitempty"`
-	MusicBrainz            MusicBrainz `json:"music_brainz" bson:"music_brainz,omitempty"`
-
-	Tags map[string]string `json:"tags" bson:"tags,omitempty"`
-}
+	// The shows, summary, and failures report cover the files that were
+	// analyzed even if a source stopped part way.
+	var result []error
+	if err := errs.Wait(); err != nil {
+		result = append(result, err)
+	}
+	// JSON Lines output only holds tracks, so there are no shows to update
+	if cfg.output == outputStorage {
+		if err := updateShows(ctx, store, a.folders); err != nil {
+			result = append(result, err)
+		}
+	}
+	a.printSummary()
 
-type MusicBrainz struct {
-	// Unique ID of the artist or band. For example, Rush has the artist id of
-	// "534ee493-bfac-4575-a44a-0ae41e2c3fe4".
-	ArtistId string `json:"artist_id" bson:"artist_id"`
-
-	// Release group is what most people would call an "album". For example,
-	// the album titled "Roll the Bones" by Rush has an release group id of
-	// "e188de4e-6d15-3ca3-be49-fa13c67a03c0".
-	ReleaseGroupId string `json:"release_group_id" bson:"release_group_id"`
-
-	// Release is a specific edition of an album. For example, the album
-	// titled "Roll the Bones" by Rush has had at least 13 different releases
-	// around the world. The original US CD release by Atlantic on 1991-09-03
-	// has the release id of "50e551bd-5d24-37e5-913d-07c25cd85e8e". Whereas
-	// the original 12" vinyl release by Atlantic was worldwide and has the
-	// release id of "52bf9926-dc7f-40b9-9a08-d5f0c98f8a63".
-	ReleaseId string `json:"release_id" bson:"release_id"`
+	if a.failed == 0 {
+		return errors.Join(result...)
+	}
+	if cfg.failuresReport != "" {
+		if err := writeFailures(cfg.failuresReport, a.failures); err != nil {
+			result = append(result, err)
+		} else {
+			logf("Wrote failures to %s\n", cfg.failuresReport)
+		}
+	}
+	result = append(result, fmt.Errorf("failed to analyze %d files", a.failed))
+	return errors.Join(result...)
 }
 
-func newMetadata(filename string, md tag.Metadata) *Metadata {
-	trackNum, _ := md.Track()
-	id := fmt.Sprintf("%s_%s_%s_%04d", md.Artist(), md.Album(), filename, trackNum)
-
-	cleanupRegEx := regexp.MustCompile(`[,_ ]+`)
-	id = cleanupRegEx.ReplaceAllString(id, "-")
-
-	m := Metadata{
-		Id:       strings.ToLower(id),
+func newMetadata(filename string, md tag.Metadata) *storage.Metadata {
+	m := storage.Metadata{
 		Filename: filename,
 		Album:    md.Album(),
 		Artist:   md.Artist(),
@@ -196,7 +334,7 @@ func newMetadata(filename string, md tag.Metadata) *Metadata {
 		if m.Date, err = time.Parse(time.DateOnly, strValue); err != nil {
 			// Try year only
 			if m.Date, err = time.Parse("2006", strValue); err != nil {
-				fmt.Printf("WARNING: unable to parse date %q for %s\n", strValue, filename)
+				logf("WARNING: unable to parse date %q for %s\n", strValue, filename)
 			}
 		}
 	}
@@ -217,9 +355,11 @@ func newMetadata(filename string, md tag.Metadata) *Metadata {
 			m.MusicBrainz.ReleaseGroupId = strValue
 		case "set":
 			if m.Set, err = strconv.Atoi(strValue); err != nil {
-				fmt.Printf("WARNING: unable to parse set # %q for %s\n", strValue, filename)
+				logf("WARNING: unable to parse set # %q for %s\n", strValue, filename)
 				continue
 			}
+		case "source":
+			m.Source = strValue
 		case "venue":
 			m.Venue = strValue
 		}
@@ -228,30 +368,110 @@ func newMetadata(filename string, md tag.Metadata) *Metadata {
 	return &m
 }
 
-func analyzeFile(storage *StorageHandler, filename string) error {
-	fmt.Printf("Processing %s\n", filename)
+func (a *analyzer) analyzeFile(filename, libraryRoot string) (storage.SaveResult, error) {
+	logf("Processing %s\n", filename)
+
+	if isInfoFile(filename) {
+		return a.analyzeInfoFile(filename)
+	} else if filepath.Ext(filename) == ".txt" {
+		logf("Skipping %s, %v: it isn't named like one\n", filename, errNotInfo)
+		return storage.SaveUnchanged, nil
+	}
+
+	ctx := context.Background()
 
-	f, err := os.Open(filename)
+	// Files are only opened once they're known to have changed, as opening
+	// a file in a compressed archive means decompressing it.
+	stat, err := archive.Stat(filename)
 	if err != nil {
-		return fmt.Errorf("error opening file %s: %v", filename, err)
+		return storage.SaveUnchanged, fail(storage.FailureOpen, fmt.Errorf("error reading file info for %s: %v", filename, err))
+	}
+	// MongoDB stores times with millisecond precision
+	modTime := stat.ModTime().UTC().Truncate(time.Millisecond)
+
+	path := filename
+	if abs, err := filepath.Abs(filename); err == nil {
+		path = abs
+	}
+	root, relPath := a.library.RelPath(path, libraryRoot)
+
+	existing, err := a.storage.FindTrackByRelPath(ctx, root, relPath)
+	if err != nil {
+		return storage.SaveUnchanged, fail(storage.FailureStorage, err)
+	}
+	if existing != nil && !a.force && existing.Size == stat.Size() && existing.ModTime.Equal(modTime) {
+		return storage.SaveUnchanged, nil
+	}
+
+	f, err := archive.Open(filename)
+	if err != nil {
+		return storage.SaveUnchanged, fail(storage.FailureOpen, fmt.Errorf("error opening file %s: %v", filename, err))
 	}
 	defer f.Close()
 
-	m, err := tag.ReadFrom(f)
+	format, err := a.audio.Detect(f, filename)
+	if err != nil {
+		return storage.SaveUnchanged, fail(storage.FailureUnsupported, fmt.Errorf("unsupported format for %s: %v", filename, err))
+	}
+	props, err := format.ReadProperties(f)
+	if err != nil {
+		return storage.SaveUnchanged, fmt.Errorf("error reading properties of %s: %v", filename, err)
+	}
+	tags, err := format.ReadTags(f)
 	if err != nil {
-		return fmt.Errorf("error reading tags from %s: %v", filename, err)
+		return storage.SaveUnchanged, fail(storage.FailureTags, fmt.Errorf("error reading tags from %s: %v", filename, err))
 	}
 
-	metadata := newMetadata(filepath.Base(filename), m)
-	if err = storage.SaveMetadata(context.Background(), metadata); err != nil {
-		return err
+	var metadata *storage.Metadata
+	if tags == nil {
+		// Files without tags, such as Shorten files, get everything from
+		// the names and the info file.
+		metadata = &storage.Metadata{
+			Filename: filepath.Base(filename),
+			Album:    filepath.Base(filepath.Dir(filename)),
+			Tags:     make(map[string]string),
+		}
+		applyNameInfo(metadata, a.names.Parse(filename))
+		a.applyFolderInfo(metadata, filename)
+	} else {
+		metadata = newMetadata(filepath.Base(filename), tags)
+		applyNameInfo(metadata, a.names.Parse(filename))
+	}
+	metadata.Folder = showFolder(filename)
+	metadata.ShowId = newShowId(metadata)
+	metadata.Path = path
+	metadata.LibraryRoot = root
+	metadata.RelPath = relPath
+	metadata.Size = stat.Size()
+	metadata.ModTime = modTime
+	applyProperties(metadata, props, stat.Size())
+
+	if metadata.ContentHash, err = library.ContentHash(f, format, filename); err != nil {
+		return storage.SaveUnchanged, err
 	}
+	if sum, ok := strings.CutPrefix(metadata.ContentHash, "md5:"); ok {
+		metadata.AudioMD5 = sum
+	}
+	metadata.Id = library.TrackId(metadata.LibraryRoot, metadata.RelPath, metadata.ContentHash)
 
-	// b, err := json.MarshalIndent(metadata, "", "  ")
-	// if err != nil {
-	// 	return fmt.Errorf("unable to marshal %s due to %s", filename, err)
-	// }
-	// fmt.Println(string(b))
+	if existing == nil || existing.Id == metadata.Id {
+		if existing != nil {
+			// Only the tags changed, so the verification still applies
+			metadata.Verification = existing.Verification
+		}
+		result, err := a.storage.SaveMetadata(ctx, metadata)
+		if err != nil {
+			return storage.SaveUnchanged, fail(storage.FailureStorage, err)
+		}
+		return result, nil
+	}
 
-	return nil
+	// The audio was replaced, which gives the track a new identity
+	if _, err := a.storage.SaveMetadata(ctx, metadata); err != nil {
+		return storage.SaveUnchanged, fail(storage.FailureStorage, err)
+	}
+	if err := a.storage.DeleteTrack(ctx, existing.Id); err != nil {
+		return storage.SaveUnchanged, fail(storage.FailureStorage, err)
+	}
+	return storage.SaveUpdated, nil
 }
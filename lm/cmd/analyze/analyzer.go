@@ -0,0 +1,155 @@
+package analyze
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+
+	"github.com/organicveggie/livemusic/lm/audio/formats"
+	"github.com/organicveggie/livemusic/lm/etree"
+	"github.com/organicveggie/livemusic/lm/library"
+	"github.com/organicveggie/livemusic/lm/storage"
+)
+
+// analyzer holds the state shared by all of the files analyzed in a run. It is
+// safe for use by multiple workers.
+type analyzer struct {
+	storage storage.Handler
+	names   *etree.Parser
+	audio   *formats.Registry
+	library *library.Library
+	force   bool
+
+	// recordFailures saves failures to the failures collection and clears
+	// them once a file is analyzed successfully.
+	recordFailures bool
+
+	// infoMu guards infoCache, the info files found in the folders of
+	// untagged tracks.
+	infoMu    sync.Mutex
+	infoCache map[string]*cachedInfo
+
+	// mu guards the folders, counts, and failures below
+	mu sync.Mutex
+
+	// Folders with at least one new or updated file. Their shows are rebuilt
+	// once all files have been processed.
+	folders map[string]bool
+
+	inserted  int
+	updated   int
+	removed   int
+	unchanged int
+	failed    int
+
+	failures []*storage.Failure
+}
+
+func newAnalyzer(storage storage.Handler, names *etree.Parser, audio *formats.Registry, library *library.Library, force, recordFailures bool) *analyzer {
+	return &analyzer{
+		storage:        storage,
+		names:          names,
+		audio:          audio,
+		library:        library,
+		force:          force,
+		recordFailures: recordFailures,
+		folders:        map[string]bool{},
+		infoCache:      map[string]*cachedInfo{},
+	}
+}
+
+// process analyzes a single file and records the outcome.
+func (a *analyzer) process(j job) error {
+	filename := j.filename
+	var result storage.SaveResult
+	var err error
+	if j.removed {
+		result, err = a.removeFile(filename, j.libraryRoot)
+	} else {
+		result, err = a.analyzeFile(filename, j.libraryRoot)
+	}
+
+	var failure *storage.Failure
+	if err != nil {
+		failure = newFailure(filename, err)
+		logf("ERROR: [%s] %v\n", failure.Reason, err)
+	}
+	if a.recordFailures {
+		a.saveFailure(filename, failure)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err != nil {
+		a.failed++
+		a.failures = append(a.failures, failure)
+		return err
+	}
+
+	switch result {
+	case storage.SaveInserted:
+		a.inserted++
+	case storage.SaveUpdated:
+		a.updated++
+	case storage.SaveRemoved:
+		a.removed++
+	default:
+		a.unchanged++
+		return nil
+	}
+	a.folders[showFolder(filename)] = true
+	return nil
+}
+
+func (a *analyzer) printSummary() {
+	logf("Inserted %d, updated %d, removed %d, unchanged %d, failed %d files\n",
+		a.inserted, a.updated, a.removed, a.unchanged, a.failed)
+}
+
+// removeFile deletes the track or info file stored for a file that a scan
+// found was removed.
+func (a *analyzer) removeFile(filename, libraryRoot string) (storage.SaveResult, error) {
+	logf("Removing %s\n", filename)
+
+	ctx := context.Background()
+	path := filename
+	if abs, err := filepath.Abs(filename); err == nil {
+		path = abs
+	}
+
+	if isInfoFile(filename) {
+		result, err := a.storage.DeleteInfo(ctx, path)
+		if err != nil {
+			return storage.SaveUnchanged, fail(storage.FailureStorage, err)
+		}
+		a.forgetFolderInfo(filename)
+		return result, nil
+	}
+
+	root, relPath := a.library.RelPath(path, libraryRoot)
+	existing, err := a.storage.FindTrackByRelPath(ctx, root, relPath)
+	if err != nil {
+		return storage.SaveUnchanged, fail(storage.FailureStorage, err)
+	}
+	if existing == nil {
+		return storage.SaveUnchanged, nil
+	}
+	if err := a.storage.DeleteTrack(ctx, existing.Id); err != nil {
+		return storage.SaveUnchanged, fail(storage.FailureStorage, err)
+	}
+	return storage.SaveRemoved, nil
+}
+
+// saveFailure records failure for filename, or clears the previous failure if
+// it's nil.
+func (a *analyzer) saveFailure(filename string, failure *storage.Failure) {
+	ctx := context.Background()
+	if failure != nil {
+		if err := a.storage.SaveFailure(ctx, failure); err != nil {
+			logf("WARNING: %v\n", err)
+		}
+	} else if err := a.storage.DeleteFailure(ctx, filename); err != nil {
+		logf("WARNING: %v\n", err)
+	}
+}
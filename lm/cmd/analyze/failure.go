@@ -0,0 +1,70 @@
+package analyze
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/organicveggie/livemusic/lm/storage"
+)
+
+// analyzeError is an error from analyzing a file along with its category.
+type analyzeError struct {
+	reason storage.FailureReason
+	err    error
+}
+
+func (e *analyzeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *analyzeError) Unwrap() error {
+	return e.err
+}
+
+// fail attaches a reason to err. Errors that already have a reason keep it.
+func fail(reason storage.FailureReason, err error) error {
+	var ae *analyzeError
+	if errors.As(err, &ae) {
+		return err
+	}
+	return &analyzeError{reason: reason, err: err}
+}
+
+// failureReason returns the category of err. Errors without one are read
+// errors.
+func failureReason(err error) storage.FailureReason {
+	var ae *analyzeError
+	if errors.As(err, &ae) {
+		return ae.reason
+	}
+	return storage.FailureRead
+}
+
+func newFailure(filename string, err error) *storage.Failure {
+	return &storage.Failure{
+		Path:     filename,
+		Reason:   failureReason(err),
+		Error:    err.Error(),
+		FailedAt: time.Now().UTC(),
+	}
+}
+
+// writeFailures writes one JSON object per failure to filename.
+func writeFailures(filename string, failures []*storage.Failure) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("error creating failures report %s: %v", filename, err)
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	for _, failure := range failures {
+		if err := enc.Encode(failure); err != nil {
+			return fmt.Errorf("error writing failures report %s: %v", filename, err)
+		}
+	}
+	return f.Close()
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"strings"
 )
 
 type FileSourceHandler struct {
@@ -34,7 +35,15 @@ func (fs *FileSourceHandler) Analyze() error {
 	scanner := bufio.NewScanner(fs.file)
 	for scanner.Scan() {
 		line := scanner.Text()
-		fs.ch <- line
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		j, err := newJob(line)
+		if err != nil {
+			logf("WARNING: skipping line in %s: %v\n", fs.sourceFileName, err)
+			continue
+		}
+		fs.ch <- j
 	}
 	return nil
 }
@@ -0,0 +1,169 @@
+package analyze
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/organicveggie/livemusic/lm/archive"
+	"github.com/organicveggie/livemusic/lm/etree"
+	"github.com/organicveggie/livemusic/lm/storage"
+)
+
+func isInfoFile(filename string) bool {
+	return etree.IsInfoFile(filename)
+}
+
+func newInfoFile(filename string, text *etree.InfoText) *storage.InfoFile {
+	info := &storage.InfoFile{
+		Id:       filename,
+		Filename: filepath.Base(filename),
+		Folder:   showFolder(filename),
+		Artist:   text.Artist,
+		Date:     text.Date,
+		Venue:    text.Venue,
+		City:     text.City,
+		Source:   text.Source,
+		Lineage:  text.Lineage,
+		Taper:    text.Taper,
+		Transfer: text.Transfer,
+	}
+	if abs, err := filepath.Abs(filename); err == nil {
+		info.Id = abs
+	}
+
+	for _, e := range text.Setlist {
+		info.Setlist = append(info.Setlist, storage.SetlistEntry{
+			Disc:     e.Disc,
+			Set:      e.Set,
+			Track:    e.Track,
+			Title:    e.Title,
+			Duration: e.Duration,
+		})
+	}
+	return info
+}
+
+// errNotInfo is returned for text files that aren't info files, such as
+// checksum files, which are skipped rather than failing.
+var errNotInfo = errors.New("not an info file")
+
+// readInfoFile parses an info text file.
+func readInfoFile(filename string) (*storage.InfoFile, error) {
+	f, err := archive.Open(filename)
+	if err != nil {
+		return nil, fail(storage.FailureOpen, fmt.Errorf("error opening file %s: %v", filename, err))
+	}
+	defer f.Close()
+
+	text, err := etree.ParseInfo(f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading info file %s: %v", filename, err)
+	}
+	if text.Empty() {
+		return nil, fmt.Errorf("%w: no show information found", errNotInfo)
+	}
+
+	return newInfoFile(filename, text), nil
+}
+
+func (a *analyzer) analyzeInfoFile(filename string) (storage.SaveResult, error) {
+	info, err := readInfoFile(filename)
+	if errors.Is(err, errNotInfo) {
+		logf("Skipping %s, %v\n", filename, err)
+		return storage.SaveUnchanged, nil
+	} else if err != nil {
+		return storage.SaveUnchanged, err
+	}
+	result, err := a.storage.SaveInfo(context.Background(), info)
+	if err != nil {
+		return storage.SaveUnchanged, fail(storage.FailureStorage, err)
+	}
+	a.forgetFolderInfo(filename)
+	return result, nil
+}
+
+// applyFolderInfo fills in details missing from metadata using the info file
+// in the same folder, if there is one.
+func (a *analyzer) applyFolderInfo(m *storage.Metadata, filename string) {
+	info := a.folderInfo(filepath.Dir(filename))
+	if info == nil {
+		return
+	}
+
+	m.Artist = cmp.Or(m.Artist, info.Artist)
+	if m.Date.IsZero() {
+		m.Date = info.Date
+	}
+	m.Venue = cmp.Or(m.Venue, info.Venue)
+	m.Taper = cmp.Or(m.Taper, info.Taper)
+
+	if entry, ok := info.SetlistEntryFor(m.Disc, m.Track); ok {
+		m.Title = cmp.Or(m.Title, entry.Title)
+		m.Set = cmp.Or(m.Set, entry.Set)
+	}
+}
+
+// maxCachedFolders limits how many folders' info files are kept, as a queue
+// source can run through a whole library.
+const maxCachedFolders = 64
+
+// cachedInfo is the info file found in a folder, or nil if there isn't one.
+type cachedInfo struct {
+	once sync.Once
+	info *storage.InfoFile
+}
+
+// folderInfo returns the info file in folder, which is only looked for and
+// parsed once for all of the folder's tracks.
+func (a *analyzer) folderInfo(folder string) *storage.InfoFile {
+	a.infoMu.Lock()
+	c, ok := a.infoCache[folder]
+	if !ok {
+		if len(a.infoCache) >= maxCachedFolders {
+			clear(a.infoCache)
+		}
+		c = &cachedInfo{}
+		a.infoCache[folder] = c
+	}
+	a.infoMu.Unlock()
+
+	c.once.Do(func() { c.info = findFolderInfo(folder) })
+	return c.info
+}
+
+// forgetFolderInfo drops the cached info file for the folder holding
+// filename, once an info file in it has changed.
+func (a *analyzer) forgetFolderInfo(filename string) {
+	a.infoMu.Lock()
+	defer a.infoMu.Unlock()
+	delete(a.infoCache, filepath.Dir(filename))
+}
+
+// findFolderInfo returns the first info file in folder that has any show
+// information.
+func findFolderInfo(folder string) *storage.InfoFile {
+	entries, err := archive.ReadDir(folder)
+	if err != nil {
+		return nil
+	}
+
+	names := []string{}
+	for _, e := range entries {
+		if !e.IsDir() && isInfoFile(e.Name()) {
+			names = append(names, e.Name())
+		}
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		if info, err := readInfoFile(filepath.Join(folder, name)); err == nil {
+			return info
+		}
+	}
+	return nil
+}
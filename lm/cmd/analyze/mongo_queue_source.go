@@ -0,0 +1,139 @@
+package analyze
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/organicveggie/livemusic/lm/mongoqueue"
+)
+
+// mongoQueuePollInterval is how often an empty queue is read again while
+// failed messages wait to be retried. Unlike SQS, leasing doesn't wait for
+// messages to arrive.
+const mongoQueuePollInterval = 5 * time.Second
+
+// MongoQueueSource analyzes files from a work queue stored in MongoDB. Like
+// SQSSource, messages are only completed once their file has been analyzed,
+// and are marked failed once they've failed maxReceives times.
+type MongoQueueSource struct {
+	ch    AnalyzeChan
+	queue *mongoqueue.Queue
+	queueOptions
+
+	pending sync.WaitGroup
+	retries retries
+
+	heldMu sync.Mutex
+	held   []*mongoqueue.Message
+}
+
+func newMongoQueueSource(ch AnalyzeChan, mongoURI, queueName string, opts queueOptions) (*MongoQueueSource, error) {
+	queue, err := mongoqueue.Open(context.Background(), mongoURI, queueName)
+	if err != nil {
+		return nil, err
+	}
+	return &MongoQueueSource{ch: ch, queue: queue, queueOptions: opts}, nil
+}
+
+func (mq *MongoQueueSource) Close() error {
+	ctx := context.Background()
+	mq.heldMu.Lock()
+	defer mq.heldMu.Unlock()
+	for _, msg := range mq.held {
+		if err := mq.queue.Release(ctx, msg); err != nil {
+			logf("WARNING: %v\n", err)
+		}
+	}
+	if len(mq.held) > 0 {
+		logf("Left %d messages on %s\n", len(mq.held), mq.queue.Name())
+	}
+	mq.held = nil
+	return mq.queue.Close(ctx)
+}
+
+func (mq *MongoQueueSource) Analyze() error {
+	ctx := context.Background()
+	for {
+		msg, err := mq.queue.Lease(ctx, mq.visibilityTimeout, mq.maxReceives)
+		if err != nil {
+			return err
+		}
+		if msg == nil {
+			// Messages that are still being analyzed may fail and be made
+			// visible again, so the queue is only done once they've finished.
+			mq.pending.Wait()
+			if !mq.retries.due() {
+				return nil
+			}
+			time.Sleep(mongoQueuePollInterval)
+			continue
+		}
+
+		logf("Received [%s] %q\n", msg.Id.Hex(), msg.Body)
+		j, err := newJob(msg.Body)
+		if err != nil {
+			logf("ERROR: [%s] %v\n", msg.Id.Hex(), err)
+			if err := mq.acknowledge(msg, err); err != nil {
+				logf("ERROR: %v\n", err)
+			}
+			continue
+		}
+
+		mq.pending.Add(1)
+		stop := mq.heartbeat(msg)
+		j.done = func(err error) {
+			defer mq.pending.Done()
+			stop()
+			if err := mq.acknowledge(msg, err); err != nil {
+				logf("ERROR: %v\n", err)
+			}
+		}
+		mq.ch <- j
+	}
+}
+
+// heartbeat extends the lease of msg halfway through each visibility timeout
+// until the returned function is called.
+func (mq *MongoQueueSource) heartbeat(msg *mongoqueue.Message) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(mq.visibilityTimeout / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := mq.queue.Extend(context.Background(), msg, mq.visibilityTimeout); err != nil {
+					logf("WARNING: %v\n", err)
+				}
+			}
+		}
+	}()
+	return sync.OnceFunc(func() { close(done) })
+}
+
+// acknowledge completes msg once its file has been analyzed. A failed message
+// is hidden for longer after each attempt and then retried, until it has been
+// leased maxReceives times, and is then marked failed with the error attached. Kept messages are hidden until
+// the source is closed instead.
+func (mq *MongoQueueSource) acknowledge(msg *mongoqueue.Message, analyzeErr error) error {
+	ctx := context.Background()
+	if mq.keep {
+		mq.heldMu.Lock()
+		defer mq.heldMu.Unlock()
+		mq.held = append(mq.held, msg)
+		return mq.queue.Extend(ctx, msg, heldVisibility)
+	}
+	if analyzeErr == nil {
+		return mq.queue.Complete(ctx, msg)
+	}
+	if msg.Attempts < mq.maxReceives {
+		delay := mq.backoff(msg.Attempts)
+		mq.retries.add(delay)
+		return mq.queue.Retry(ctx, msg, analyzeErr, delay)
+	}
+	logf("Marked [%s] failed after %d attempts\n", msg.Id.Hex(), msg.Attempts)
+	return mq.queue.Fail(ctx, msg, analyzeErr)
+}
@@ -0,0 +1,51 @@
+package analyze
+
+import (
+	"cmp"
+	"strings"
+	"time"
+
+	"github.com/organicveggie/livemusic/lm/etree"
+	"github.com/organicveggie/livemusic/lm/storage"
+)
+
+// applyNameInfo fills in metadata from information parsed out of the folder
+// and file name. The etree naming convention is more reliable than the tags
+// found on traded recordings, so the name wins when the date, disc, set, or
+// track disagree. The artist is only replaced when the abbreviation is known.
+func applyNameInfo(m *storage.Metadata, info etree.Info) {
+	if info.Artist != "" && !strings.EqualFold(m.Artist, info.Artist) {
+		if m.Artist != "" {
+			logf("WARNING: artist tag %q disagrees with name %q for %s\n", m.Artist, info.Artist, m.Filename)
+		}
+		m.Artist = info.Artist
+	}
+
+	if !info.Date.IsZero() && !m.Date.Equal(info.Date) {
+		// A year only tag that matches the name is not a disagreement
+		if !m.Date.IsZero() && m.Date.Year() != info.Date.Year() {
+			logf("WARNING: date tag %s disagrees with name %s for %s\n",
+				m.Date.Format(time.DateOnly), info.Date.Format(time.DateOnly), m.Filename)
+		}
+		m.Date = info.Date
+	}
+
+	m.Disc = overrideInt(m.Disc, info.Disc, "disc", m.Filename)
+	m.Set = overrideInt(m.Set, info.Set, "set", m.Filename)
+	m.Track = overrideInt(m.Track, info.Track, "track", m.Filename)
+
+	m.Source = cmp.Or(m.Source, info.Source)
+	m.Taper = cmp.Or(m.Taper, info.Taper)
+	m.Shnid = cmp.Or(m.Shnid, info.Shnid)
+	m.BitDepth = cmp.Or(m.BitDepth, info.BitDepth)
+}
+
+func overrideInt(tagValue, nameValue int, field, filename string) int {
+	if nameValue == 0 || tagValue == nameValue {
+		return tagValue
+	}
+	if tagValue != 0 {
+		logf("WARNING: %s tag %d disagrees with name %d for %s\n", field, tagValue, nameValue, filename)
+	}
+	return nameValue
+}
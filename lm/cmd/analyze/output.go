@@ -0,0 +1,44 @@
+package analyze
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// logOut receives progress messages. It's switched to stderr when results
+// are written to stdout, to keep them separate.
+var logOut io.Writer = os.Stdout
+
+func logf(format string, args ...any) {
+	fmt.Fprintf(logOut, format, args...)
+}
+
+type outputFormat string
+
+const (
+	outputStorage outputFormat = "storage"
+	outputJSONL   outputFormat = "jsonl"
+)
+
+// String is used both by fmt.Print and by Cobra in help text
+func (e *outputFormat) String() string {
+	return string(*e)
+}
+
+// Set must have pointer receiver so it doesn't change the value of a copy
+func (e *outputFormat) Set(v string) error {
+	switch v {
+	case "storage", "jsonl":
+		*e = outputFormat(v)
+		return nil
+	default:
+		return errors.New(`must be one of "storage" or "jsonl"`)
+	}
+}
+
+// Type is only used in help text
+func (e *outputFormat) Type() string {
+	return "outputFormat"
+}
@@ -0,0 +1,25 @@
+package analyze
+
+import (
+	"github.com/organicveggie/livemusic/lm/audio/formats"
+	"github.com/organicveggie/livemusic/lm/storage"
+)
+
+// applyProperties fills in the technical audio properties of a track. The
+// bitrate of streams that don't record it is the average over the whole file.
+// Lossy streams have no bit depth, so the one from the name, if any, is kept.
+func applyProperties(m *storage.Metadata, p *formats.Properties, size int64) {
+	m.Codec = p.Codec
+	if p.BitDepth != 0 {
+		m.BitDepth = p.BitDepth
+	}
+	m.Channels = p.Channels
+	m.SampleRate = p.SampleRate
+	m.Samples = p.Samples
+	m.Duration = p.Duration
+	m.Bitrate = p.Bitrate
+
+	if m.Bitrate == 0 && m.Duration > 0 {
+		m.Bitrate = int(float64(size*8) / m.Duration.Seconds())
+	}
+}
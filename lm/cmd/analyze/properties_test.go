@@ -0,0 +1,54 @@
+package analyze
+
+import (
+	"testing"
+	"time"
+
+	"github.com/organicveggie/livemusic/lm/audio/formats"
+	"github.com/organicveggie/livemusic/lm/storage"
+)
+
+func TestApplyPropertiesBitrate(t *testing.T) {
+	tests := []struct {
+		name string
+		p    formats.Properties
+		size int64
+		want int
+	}{
+		{"recorded", formats.Properties{Duration: time.Minute, Bitrate: 320000}, 1 << 20, 320000},
+		{"average", formats.Properties{Duration: 10 * time.Second}, 1_000_000, 800000},
+		{"large file", formats.Properties{Duration: 1000 * time.Second}, 2_000_000_000, 16000000},
+		{"no duration", formats.Properties{}, 1_000_000, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m storage.Metadata
+			applyProperties(&m, &tt.p, tt.size)
+			if m.Bitrate != tt.want {
+				t.Errorf("Bitrate = %d, want %d", m.Bitrate, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyPropertiesBitDepth(t *testing.T) {
+	tests := []struct {
+		name string
+		from int
+		p    formats.Properties
+		want int
+	}{
+		{"stream", 16, formats.Properties{BitDepth: 24}, 24},
+		{"name", 16, formats.Properties{Codec: "mp3"}, 16},
+		{"neither", 0, formats.Properties{Codec: "mp3"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := storage.Metadata{BitDepth: tt.from}
+			applyProperties(&m, &tt.p, 0)
+			if m.BitDepth != tt.want {
+				t.Errorf("BitDepth = %d, want %d", m.BitDepth, tt.want)
+			}
+		})
+	}
+}
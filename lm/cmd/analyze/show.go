@@ -0,0 +1,158 @@
+package analyze
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/organicveggie/livemusic/lm/storage"
+)
+
+// showFolder returns the absolute folder containing filename, falling back
+// to the folder as given if it can't be made absolute.
+func showFolder(filename string) string {
+	folder := filepath.Dir(filename)
+	if abs, err := filepath.Abs(folder); err == nil {
+		return abs
+	}
+	return folder
+}
+
+// newShowId builds the identifier of the show a track belongs to.
+func newShowId(m *storage.Metadata) string {
+	date := ""
+	if !m.Date.IsZero() {
+		date = m.Date.Format(time.DateOnly)
+	}
+
+	// The folder is hashed to keep the identifier readable while still
+	// separating shows that only differ by location.
+	folderHash := fmt.Sprintf("%x", sha1.Sum([]byte(m.Folder)))[:8]
+	id := fmt.Sprintf("%s_%s_%s_%s", m.Artist, date, m.Source, folderHash)
+
+	cleanupRegEx := regexp.MustCompile(`[,_ ]+`)
+	return strings.ToLower(cleanupRegEx.ReplaceAllString(id, "-"))
+}
+
+// buildShows groups tracks into shows, ordering discs, sets, and tracks. info
+// may be nil if the folder has no info file.
+func buildShows(tracks []*storage.Metadata, info *storage.InfoFile) []*storage.Show {
+	byId := map[string][]*storage.Metadata{}
+	for _, t := range tracks {
+		byId[t.ShowId] = append(byId[t.ShowId], t)
+	}
+
+	shows := []*storage.Show{}
+	for _, id := range slices.Sorted(maps.Keys(byId)) {
+		show := newShow(id, byId[id])
+		if info != nil {
+			applyShowInfo(show, info)
+		}
+		shows = append(shows, show)
+	}
+	return shows
+}
+
+func newShow(id string, tracks []*storage.Metadata) *storage.Show {
+	slices.SortFunc(tracks, func(a, b *storage.Metadata) int {
+		return cmp.Or(
+			cmp.Compare(a.Disc, b.Disc),
+			cmp.Compare(a.Set, b.Set),
+			cmp.Compare(a.Track, b.Track),
+			cmp.Compare(a.Filename, b.Filename),
+		)
+	})
+
+	first := tracks[0]
+	show := &storage.Show{
+		Id:     id,
+		Folder: first.Folder,
+		Artist: first.Artist,
+		Date:   first.Date,
+		Source: first.Source,
+		Taper:  first.Taper,
+	}
+
+	for _, t := range tracks {
+		show.Venue = cmp.Or(show.Venue, t.Venue)
+		show.Duration += t.Duration
+		show.TrackCount++
+
+		if len(show.Discs) == 0 || show.Discs[len(show.Discs)-1].Number != t.Disc {
+			show.Discs = append(show.Discs, storage.ShowDisc{Number: t.Disc})
+		}
+		disc := &show.Discs[len(show.Discs)-1]
+
+		if len(disc.Sets) == 0 || disc.Sets[len(disc.Sets)-1].Number != t.Set {
+			disc.Sets = append(disc.Sets, storage.ShowSet{Number: t.Set})
+		}
+		set := &disc.Sets[len(disc.Sets)-1]
+
+		set.Tracks = append(set.Tracks, storage.ShowTrack{
+			TrackId:  t.Id,
+			Number:   t.Track,
+			Title:    t.Title,
+			Filename: t.Filename,
+			Duration: t.Duration,
+		})
+	}
+
+	return show
+}
+
+// applyShowInfo fills in details of s from an info file.
+func applyShowInfo(s *storage.Show, info *storage.InfoFile) {
+	s.InfoId = info.Id
+	s.Artist = cmp.Or(s.Artist, info.Artist)
+	if s.Date.IsZero() {
+		s.Date = info.Date
+	}
+	s.Venue = cmp.Or(s.Venue, info.Venue)
+	s.City = info.City
+	s.Lineage = info.Lineage
+	s.Taper = cmp.Or(s.Taper, info.Taper)
+	s.Transfer = info.Transfer
+
+	for i := range s.Discs {
+		disc := &s.Discs[i]
+		for j := range disc.Sets {
+			set := &disc.Sets[j]
+			for k := range set.Tracks {
+				track := &set.Tracks[k]
+				if entry, ok := info.SetlistEntryFor(disc.Number, track.Number); ok {
+					track.Title = cmp.Or(track.Title, entry.Title)
+				}
+			}
+		}
+	}
+}
+
+// updateShows rebuilds the shows for each folder from the tracks stored for
+// that folder.
+func updateShows(ctx context.Context, storage storage.Handler, folders map[string]bool) error {
+	for _, folder := range slices.Sorted(maps.Keys(folders)) {
+		tracks, err := storage.FindTracksByFolder(ctx, folder)
+		if err != nil {
+			return err
+		}
+
+		info, err := storage.FindInfoByFolder(ctx, folder)
+		if err != nil {
+			return err
+		}
+
+		shows := buildShows(tracks, info)
+		if err := storage.ReplaceShows(ctx, folder, shows); err != nil {
+			return err
+		}
+		logf("Updated %d show(s) in %s\n", len(shows), folder)
+	}
+	return nil
+}
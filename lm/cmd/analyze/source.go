@@ -12,13 +12,15 @@ const (
 	SourceCLI
 	SourceFile
 	SourceSQS
+	SourceMongo
 )
 
 var sourceName = map[Source]string{
-	SourceNone: "none",
-	SourceCLI:  "cli",
-	SourceFile: "file",
-	SourceSQS:  "sqs",
+	SourceNone:  "none",
+	SourceCLI:   "cli",
+	SourceFile:  "file",
+	SourceSQS:   "sqs",
+	SourceMongo: "mongo",
 }
 
 func (s *Source) String() string {
@@ -2,6 +2,10 @@ package analyze
 
 import (
 	"fmt"
+	"maps"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -15,42 +19,88 @@ type SQSSource struct {
 	maxMessages     int
 	queueName       string
 	waitTimeoutSecs int
+	queueOptions
 
 	client   *sqs.SQS
 	queueURL string
+	deadURL  string
 	session  *session.Session
+	pending  sync.WaitGroup
+	retries  retries
+
+	heldMu sync.Mutex
+	held   []*sqs.Message
+}
+
+// queueOptions controls how messages are acknowledged.
+type queueOptions struct {
+	// deadLetterQueue is the name of the queue that messages are moved to
+	// once they have failed maxReceives times. They're deleted when it is
+	// empty.
+	deadLetterQueue string
+	maxReceives     int
+	// retryDelay is how much longer a failed message is hidden for after
+	// each attempt, so that a file that fails again right away isn't retried
+	// in a tight loop.
+	retryDelay        time.Duration
+	visibilityTimeout time.Duration
+	// keep leaves messages on the queue, for when results aren't saved. They
+	// stay hidden once analyzed, so that each is only analyzed once, and are
+	// made visible again when the source is closed.
+	keep bool
+}
+
+// heldVisibility is how long kept messages are hidden for, in case the source
+// isn't closed. It's the longest that SQS allows.
+const heldVisibility = 12 * time.Hour
+
+// backoff returns how long a message that has failed attempts times is hidden
+// for before it's retried.
+func (o queueOptions) backoff(attempts int) time.Duration {
+	return min(time.Duration(attempts)*o.retryDelay, heldVisibility)
+}
+
+// retries tracks when the last of the failed messages becomes visible again,
+// so that sources keep reading an empty queue until their retries are due.
+type retries struct {
+	mu sync.Mutex
+	at time.Time
+}
+
+func (r *retries) add(delay time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if at := time.Now().Add(delay); at.After(r.at) {
+		r.at = at
+	}
 }
 
-func newSQSSource(ch AnalyzeChan, profile, queueName string) (*SQSSource, error) {
+// due reports whether a retry was visible by now or is yet to be, and
+// forgets the retries that were.
+func (r *retries) due() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.at.IsZero() {
+		return false
+	}
+	if time.Now().After(r.at) {
+		r.at = time.Time{}
+	}
+	return true
+}
+
+func newSQSSource(ch AnalyzeChan, settings sqsh.Settings, queueName string, opts queueOptions) (*SQSSource, error) {
 	q := &SQSSource{
 		ch:              ch,
 		maxMessages:     10,
 		queueName:       queueName,
 		waitTimeoutSecs: 15,
+		queueOptions:    opts,
 	}
 
-	// Setup AWS session options
-	options := session.Options{
-		// Provide SDK Config options, such as Region.
-		Config: aws.Config{
-			Region: aws.String("us-west-2"),
-		},
-		// Force enable Shared Config support
-		SharedConfigState: session.SharedConfigEnable,
-	}
-	if profile != "" {
-		// Specify profile to load for the session's config
-		options.Profile = profile
-	}
-
-	// Create the AWS session
 	var err error
-	q.session, err = session.NewSessionWithOptions(options)
-	if err != nil {
-		return nil, fmt.Errorf("error creating AWS session: %v", err)
-	}
-	if _, err = q.session.Config.Credentials.Get(); err != nil {
-		return nil, fmt.Errorf("error loading AWS credentials: %v", err)
+	if q.session, err = sqsh.NewSession(settings); err != nil {
+		return nil, err
 	}
 
 	// Create the SQS client
@@ -60,24 +110,43 @@ func newSQSSource(ch AnalyzeChan, profile, queueName string) (*SQSSource, error)
 	if q.queueURL, err = sqsh.GetQueueURL(q.client, q.queueName); err != nil {
 		return nil, err
 	}
+	if q.deadLetterQueue != "" {
+		if q.deadURL, err = sqsh.GetQueueURL(q.client, q.deadLetterQueue); err != nil {
+			return nil, err
+		}
+	}
 
 	return q, nil
 }
 
 func (sq *SQSSource) Close() error {
+	sq.heldMu.Lock()
+	defer sq.heldMu.Unlock()
+	for _, msg := range sq.held {
+		if err := sq.setVisibility(msg, 0); err != nil {
+			logf("WARNING: %v\n", err)
+		}
+	}
+	if len(sq.held) > 0 {
+		logf("Left %d messages on %s\n", len(sq.held), sq.queueName)
+	}
+	sq.held = nil
 	return nil
 }
 
 func (sq *SQSSource) Analyze() error {
-	hasMoreMessages := true
-	for hasMoreMessages {
+	for {
 		msgIn := sqs.ReceiveMessageInput{
+			AttributeNames: []*string{
+				aws.String(sqs.MessageSystemAttributeNameApproximateReceiveCount),
+			},
 			MaxNumberOfMessages: aws.Int64(int64(sq.maxMessages)),
 			MessageAttributeNames: []*string{
 				aws.String(sqs.QueueAttributeNameAll),
 			},
-			QueueUrl:        &sq.queueURL,
-			WaitTimeSeconds: aws.Int64(int64(sq.waitTimeoutSecs)),
+			QueueUrl:          &sq.queueURL,
+			VisibilityTimeout: aws.Int64(int64(sq.visibilityTimeout / time.Second)),
+			WaitTimeSeconds:   aws.Int64(int64(sq.waitTimeoutSecs)),
 		}
 
 		recvMsg, err := sq.client.ReceiveMessage(&msgIn)
@@ -85,20 +154,140 @@ func (sq *SQSSource) Analyze() error {
 			return fmt.Errorf("error reading SQS messages from %s: %v", sq.queueURL, err)
 		}
 
-		for _, msg := range recvMsg.Messages {
-			fmt.Printf("Received [%s] %q\n", *msg.MessageId, *msg.Body)
-			sq.ch <- *msg.Body
+		if len(recvMsg.Messages) == 0 {
+			// Messages that are still being analyzed may fail and be made
+			// visible again, so the queue is only done once they've finished.
+			sq.pending.Wait()
+			if !sq.retries.due() {
+				return nil
+			}
+			continue
+		}
+
+		// The messages wait their turn for a worker while hidden, so they're
+		// all kept hidden from the start rather than once they're handed out.
+		stops := make([]func(), len(recvMsg.Messages))
+		for i, msg := range recvMsg.Messages {
+			stops[i] = sq.heartbeat(msg)
+		}
+
+		for i, msg := range recvMsg.Messages {
+			stop := stops[i]
+			logf("Received [%s] %q\n", *msg.MessageId, *msg.Body)
+			j, err := newJob(*msg.Body)
+			if err != nil {
+				logf("ERROR: [%s] %v\n", *msg.MessageId, err)
+				stop()
+				if err := sq.acknowledge(msg, err); err != nil {
+					logf("ERROR: %v\n", err)
+				}
+				continue
+			}
+
+			sq.pending.Add(1)
+			j.done = func(err error) {
+				defer sq.pending.Done()
+				stop()
+				if err := sq.acknowledge(msg, err); err != nil {
+					logf("ERROR: %v\n", err)
+				}
+			}
+			sq.ch <- j
+		}
+	}
+}
 
-			if _, err := sq.client.DeleteMessage(&sqs.DeleteMessageInput{
-				QueueUrl:      &sq.queueURL,
-				ReceiptHandle: msg.ReceiptHandle,
-			}); err != nil {
-				return fmt.Errorf("error deleting [%s] from %s: %v", *msg.ReceiptHandle, sq.queueURL, err)
+// heartbeat keeps msg hidden from other consumers until the returned function
+// is called, by extending its visibility timeout halfway through each period.
+func (sq *SQSSource) heartbeat(msg *sqs.Message) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(sq.visibilityTimeout / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := sq.setVisibility(msg, sq.visibilityTimeout); err != nil {
+					logf("WARNING: %v\n", err)
+				}
 			}
 		}
+	}()
+	return sync.OnceFunc(func() { close(done) })
+}
+
+// acknowledge deletes msg once its file has been analyzed. A failed message is
+// hidden for longer after each attempt and then retried, until it has been
+// received maxReceives times. It's then moved to the dead-letter queue with
+// the error attached, or deleted if there isn't one. Kept messages are hidden
+// until the source is closed instead.
+func (sq *SQSSource) acknowledge(msg *sqs.Message, analyzeErr error) error {
+	if sq.keep {
+		sq.heldMu.Lock()
+		defer sq.heldMu.Unlock()
+		sq.held = append(sq.held, msg)
+		return sq.setVisibility(msg, heldVisibility)
+	}
+	if analyzeErr == nil {
+		return sq.delete(msg)
+	}
 
-		hasMoreMessages = len(recvMsg.Messages) > 0
+	receives, _ := strconv.Atoi(aws.StringValue(msg.Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount]))
+	if receives < sq.maxReceives {
+		delay := sq.backoff(receives)
+		sq.retries.add(delay)
+		return sq.setVisibility(msg, delay)
 	}
 
+	if sq.deadURL == "" {
+		logf("WARNING: deleted [%s] %q after %d attempts, as no --dead_letter_queue is set: %v\n", *msg.MessageId, *msg.Body, receives, analyzeErr)
+		return sq.delete(msg)
+	}
+
+	attrs := map[string]*sqs.MessageAttributeValue{}
+	maps.Copy(attrs, msg.MessageAttributes)
+	attrs["error"] = &sqs.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(analyzeErr.Error()),
+	}
+	attrs["receive_count"] = &sqs.MessageAttributeValue{
+		DataType:    aws.String("Number"),
+		StringValue: aws.String(strconv.Itoa(receives)),
+	}
+	attrs["source_queue"] = &sqs.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(sq.queueName),
+	}
+	if _, err := sq.client.SendMessage(&sqs.SendMessageInput{
+		MessageAttributes: attrs,
+		MessageBody:       msg.Body,
+		QueueUrl:          &sq.deadURL,
+	}); err != nil {
+		return fmt.Errorf("error sending [%s] to %s: %v", *msg.MessageId, sq.deadURL, err)
+	}
+	logf("Moved [%s] to %s after %d attempts\n", *msg.MessageId, sq.deadLetterQueue, receives)
+	return sq.delete(msg)
+}
+
+func (sq *SQSSource) delete(msg *sqs.Message) error {
+	if _, err := sq.client.DeleteMessage(&sqs.DeleteMessageInput{
+		QueueUrl:      &sq.queueURL,
+		ReceiptHandle: msg.ReceiptHandle,
+	}); err != nil {
+		return fmt.Errorf("error deleting [%s] from %s: %v", *msg.MessageId, sq.queueURL, err)
+	}
+	return nil
+}
+
+func (sq *SQSSource) setVisibility(msg *sqs.Message, timeout time.Duration) error {
+	if _, err := sq.client.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          &sq.queueURL,
+		ReceiptHandle:     msg.ReceiptHandle,
+		VisibilityTimeout: aws.Int64(int64(timeout / time.Second)),
+	}); err != nil {
+		return fmt.Errorf("error changing visibility of [%s] in %s: %v", *msg.MessageId, sq.queueURL, err)
+	}
 	return nil
 }
@@ -0,0 +1,46 @@
+package analyze
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	o := queueOptions{retryDelay: 30 * time.Second}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{3, 90 * time.Second},
+		{10000, heldVisibility},
+	}
+	for _, tt := range tests {
+		if got := o.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestRetriesDue(t *testing.T) {
+	var r retries
+	if r.due() {
+		t.Error("due() = true with no retries")
+	}
+
+	r.add(time.Hour)
+	r.add(0)
+	if !r.due() || !r.due() {
+		t.Error("due() = false before the last retry is visible")
+	}
+
+	r = retries{}
+	r.add(0)
+	time.Sleep(time.Millisecond)
+	if !r.due() {
+		t.Error("due() = false for a retry that just became visible")
+	}
+	if r.due() {
+		t.Error("due() = true once the retries were read")
+	}
+}
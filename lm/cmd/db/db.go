@@ -0,0 +1,148 @@
+package db
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/organicveggie/livemusic/lm/audio/formats"
+	"github.com/organicveggie/livemusic/lm/library"
+	"github.com/organicveggie/livemusic/lm/storage"
+	"github.com/spf13/cobra"
+)
+
+type commandConfig struct {
+	libraryRoots []string
+	mongoURI     string
+}
+
+func (c *commandConfig) checkFlags() error {
+	c.mongoURI = cmp.Or(c.mongoURI, os.Getenv("MONGODB_URI"))
+	if c.mongoURI == "" {
+		return fmt.Errorf("missing required storage connection string")
+	}
+	return nil
+}
+
+var (
+	cfg commandConfig
+
+	Cmd = &cobra.Command{
+		Use:   "db",
+		Short: "Set up and migrate the database",
+	}
+
+	initCmd = &cobra.Command{
+		Use:          "init",
+		Short:        "Create collections, indexes, and validators",
+		Args:         cobra.NoArgs,
+		RunE:         initDB,
+		SilenceUsage: true,
+	}
+
+	migrateCmd = &cobra.Command{
+		Use:          "migrate",
+		Short:        "Apply pending migrations and update indexes and validators",
+		Args:         cobra.NoArgs,
+		RunE:         migrateDB,
+		SilenceUsage: true,
+	}
+)
+
+func init() {
+	Cmd.PersistentFlags().StringVarP(&cfg.mongoURI, "mongodb_uri", "m", "", "MongoDB connection string, or sqlite:///path/lm.db for a local SQLite database")
+	migrateCmd.Flags().StringSliceVarP(&cfg.libraryRoots, "library_root", "l", nil, "Library root folders that track paths are stored relative to")
+
+	Cmd.AddCommand(initCmd)
+	Cmd.AddCommand(migrateCmd)
+}
+
+// connect runs fn with the database, which must record a schema version.
+func connect(cmd *cobra.Command, fn func(ctx context.Context, s storage.Handler, v storage.Versioned) error) error {
+	if err := cfg.checkFlags(); err != nil {
+		return err
+	}
+
+	ctx := cmp.Or(cmd.Context(), context.Background())
+	s, err := storage.Open(cfg.mongoURI)
+	if err != nil {
+		return fmt.Errorf("error opening storage %q: %v", cfg.mongoURI, err)
+	}
+	defer s.Close(ctx)
+
+	v, ok := s.(storage.Versioned)
+	if !ok {
+		return fmt.Errorf("storage %q doesn't record a schema version", cfg.mongoURI)
+	}
+	return fn(ctx, s, v)
+}
+
+// ensureSchema sets up the collections of MongoDB databases. SQLite databases
+// get their tables when they're opened.
+func ensureSchema(ctx context.Context, s storage.Handler) error {
+	if m, ok := s.(*storage.Mongo); ok {
+		return ensureCollections(ctx, m.Database())
+	}
+	return nil
+}
+
+func initDB(cmd *cobra.Command, args []string) error {
+	return connect(cmd, func(ctx context.Context, s storage.Handler, v storage.Versioned) error {
+		version, found, err := v.SchemaVersion(ctx)
+		if err != nil {
+			return err
+		}
+		if found {
+			fmt.Printf("Database is already at schema version %d\n", version)
+		}
+
+		if !found {
+			// A new database starts at the latest version, but tracks saved
+			// before versioning began may need every migration.
+			hasTracks, err := v.HasTracks(ctx)
+			if err != nil {
+				return err
+			}
+			if !hasTracks {
+				version = latestVersion()
+			}
+			if err := v.SetSchemaVersion(ctx, version); err != nil {
+				return err
+			}
+			fmt.Printf("Set schema version to %d\n", version)
+		}
+
+		if err := ensureSchema(ctx, s); err != nil {
+			return err
+		}
+		if version < latestVersion() {
+			fmt.Printf("%d migration(s) pending, run `lm db migrate`\n", latestVersion()-version)
+		}
+		return nil
+	})
+}
+
+func migrateDB(cmd *cobra.Command, args []string) error {
+	return connect(cmd, func(ctx context.Context, s storage.Handler, v storage.Versioned) error {
+		if _, found, err := v.SchemaVersion(ctx); err != nil {
+			return err
+		} else if !found {
+			return fmt.Errorf("database has no schema version, run `lm db init` first")
+		}
+
+		audio, err := formats.New(nil, nil)
+		if err != nil {
+			return err
+		}
+		if err := Migrate(ctx, s, &Options{Library: library.New(cfg.libraryRoots), Audio: audio}); err != nil {
+			return err
+		}
+
+		if err := ensureSchema(ctx, s); err != nil {
+			return err
+		}
+		fmt.Printf("Database is at schema version %d\n", latestVersion())
+		return nil
+	})
+}
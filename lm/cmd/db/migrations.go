@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/organicveggie/livemusic/lm/audio/formats"
+	"github.com/organicveggie/livemusic/lm/library"
+	"github.com/organicveggie/livemusic/lm/storage"
+)
+
+// migration updates documents saved by older versions of lm. Migrations are
+// applied in order, and each one's version is recorded once it succeeds, so
+// they must be safe to apply again if a later one fails.
+type migration struct {
+	version     int
+	description string
+	apply       func(ctx context.Context, s storage.Handler, opts *Options) error
+}
+
+// Options holds what migrations need besides the database.
+type Options struct {
+	// Library holds the library roots that track paths are relative to.
+	Library *library.Library
+	// Audio reads the audio files of tracks.
+	Audio *formats.Registry
+}
+
+// migrations must be numbered from 1 without gaps. Add one whenever a change
+// to the documents saved by analyze requires existing documents to change.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "Baseline schema of tracks, shows, info, and failures",
+		apply: func(ctx context.Context, s storage.Handler, opts *Options) error {
+			// The collections, indexes, and validators are created by
+			// ensureSchema after the migrations have been applied.
+			return nil
+		},
+	},
+	{
+		version:     2,
+		description: "Identify tracks by library root, relative path, and content hash",
+		apply:       migrateTrackIds,
+	},
+}
+
+func latestVersion() int {
+	return len(migrations)
+}
+
+// Migrate applies the migrations that s hasn't had yet. Databases without a
+// schema version get every migration.
+func Migrate(ctx context.Context, s storage.Handler, opts *Options) error {
+	v, ok := s.(storage.Versioned)
+	if !ok {
+		return fmt.Errorf("storage doesn't support migrations")
+	}
+	version, _, err := v.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if version > latestVersion() {
+		return fmt.Errorf("database schema version %d is newer than this lm, which supports up to %d", version, latestVersion())
+	}
+
+	for _, m := range migrations[version:] {
+		fmt.Printf("Applying migration %d: %s\n", m.version, m.description)
+		if err := m.apply(ctx, s, opts); err != nil {
+			return fmt.Errorf("error applying migration %d: %v", m.version, err)
+		}
+		if err := v.SetSchemaVersion(ctx, m.version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	tracksCollectionName   = "tracks"
+	showsCollectionName    = "shows"
+	infoCollectionName     = "info"
+	failuresCollectionName = "failures"
+	metaCollectionName     = "meta"
+	queueCollectionName    = "queue"
+)
+
+// collection describes a collection that analyze saves documents to.
+type collection struct {
+	name      string
+	validator bson.M
+	indexes   []bson.D
+}
+
+// Validators only check the fields that analyze always sets, and use the
+// moderate level so that documents saved before a field was added can still
+// be updated.
+var collections = []collection{
+	{
+		name: tracksCollectionName,
+		validator: jsonSchema([]string{"filename", "folder", "path", "rel_path", "content_hash"}, bson.M{
+			"filename":     str,
+			"folder":       str,
+			"path":         str,
+			"rel_path":     str,
+			"content_hash": str,
+			"artist":       str,
+			"title":        str,
+			"date":         date,
+			"venue":        str,
+			"disc":         integer,
+			"set":          integer,
+			"track":        integer,
+			"duration":     integer,
+			"audio_md5":    str,
+			"size":         integer,
+			"mod_time":     date,
+		}),
+		indexes: []bson.D{
+			{{Key: "artist", Value: 1}},
+			{{Key: "date", Value: 1}},
+			{{Key: "venue", Value: 1}},
+			{{Key: "filename", Value: 1}},
+			{{Key: "audio_md5", Value: 1}},
+			{{Key: "accoustic_id_fingerprint", Value: 1}},
+			{{Key: "folder", Value: 1}, {Key: "filename", Value: 1}},
+			{{Key: "library_root", Value: 1}, {Key: "rel_path", Value: 1}},
+			{{Key: "content_hash", Value: 1}},
+		},
+	},
+	{
+		name: showsCollectionName,
+		validator: jsonSchema([]string{"folder", "artist", "discs"}, bson.M{
+			"folder":      str,
+			"artist":      str,
+			"date":        date,
+			"venue":       str,
+			"discs":       bson.M{"bsonType": "array"},
+			"duration":    integer,
+			"track_count": integer,
+		}),
+		indexes: []bson.D{
+			{{Key: "artist", Value: 1}},
+			{{Key: "date", Value: 1}},
+			{{Key: "venue", Value: 1}},
+			{{Key: "folder", Value: 1}},
+		},
+	},
+	{
+		name: infoCollectionName,
+		validator: jsonSchema([]string{"filename", "folder"}, bson.M{
+			"filename": str,
+			"folder":   str,
+			"artist":   str,
+			"date":     date,
+			"venue":    str,
+		}),
+		indexes: []bson.D{
+			{{Key: "folder", Value: 1}, {Key: "filename", Value: 1}},
+			{{Key: "artist", Value: 1}},
+			{{Key: "date", Value: 1}},
+			{{Key: "venue", Value: 1}},
+		},
+	},
+	{
+		name: failuresCollectionName,
+		validator: jsonSchema([]string{"reason", "error", "failed_at"}, bson.M{
+			"reason":    str,
+			"error":     str,
+			"failed_at": date,
+		}),
+		indexes: []bson.D{
+			{{Key: "reason", Value: 1}},
+		},
+	},
+	{
+		name: queueCollectionName,
+		validator: jsonSchema([]string{"queue", "body", "status", "attempts", "visible_at"}, bson.M{
+			"queue":      str,
+			"body":       str,
+			"status":     bson.M{"enum": bson.A{"pending", "leased", "done", "failed"}},
+			"attempts":   integer,
+			"visible_at": date,
+		}),
+		indexes: []bson.D{
+			{{Key: "queue", Value: 1}, {Key: "status", Value: 1}, {Key: "visible_at", Value: 1}},
+		},
+	},
+	{
+		name: metaCollectionName,
+	},
+}
+
+var (
+	str     = bson.M{"bsonType": "string"}
+	date    = bson.M{"bsonType": "date"}
+	integer = bson.M{"bsonType": bson.A{"int", "long"}}
+)
+
+func jsonSchema(required []string, properties bson.M) bson.M {
+	return bson.M{"$jsonSchema": bson.M{
+		"bsonType":   "object",
+		"required":   required,
+		"properties": properties,
+	}}
+}
+
+// ensureCollections creates any missing collections and indexes and updates
+// the validators of existing collections. It's safe to run repeatedly.
+func ensureCollections(ctx context.Context, db *mongo.Database) error {
+	existing, err := db.ListCollectionNames(ctx, bson.D{})
+	if err != nil {
+		return fmt.Errorf("error listing collections: %v", err)
+	}
+
+	for _, c := range collections {
+		if !slices.Contains(existing, c.name) {
+			opts := options.CreateCollection()
+			if c.validator != nil {
+				opts.SetValidator(c.validator).SetValidationLevel("moderate")
+			}
+			if err := db.CreateCollection(ctx, c.name, opts); err != nil {
+				return fmt.Errorf("error creating collection %s: %v", c.name, err)
+			}
+			fmt.Printf("Created collection %s\n", c.name)
+		} else if c.validator != nil {
+			cmd := bson.D{
+				{Key: "collMod", Value: c.name},
+				{Key: "validator", Value: c.validator},
+				{Key: "validationLevel", Value: "moderate"},
+			}
+			if err := db.RunCommand(ctx, cmd).Err(); err != nil {
+				return fmt.Errorf("error updating validator of %s: %v", c.name, err)
+			}
+		}
+
+		if len(c.indexes) == 0 {
+			continue
+		}
+		models := []mongo.IndexModel{}
+		for _, keys := range c.indexes {
+			models = append(models, mongo.IndexModel{Keys: keys})
+		}
+		if _, err := db.Collection(c.name).Indexes().CreateMany(ctx, models); err != nil {
+			return fmt.Errorf("error creating indexes on %s: %v", c.name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/organicveggie/livemusic/lm/library"
+	"github.com/organicveggie/livemusic/lm/storage"
+)
+
+// migrateTrackIds moves tracks saved with the original artist, album, and
+// filename identifiers to library relative path and content hash identifiers,
+// and updates the shows that list them. The first versions of analyze didn't
+// record the folder of a track, so those tracks are found by filename in the
+// library roots. The migration fails if any track can't be moved, so that it's
+// applied again once the files can be found.
+func migrateTrackIds(ctx context.Context, s storage.Handler, opts *Options) error {
+	tracks, err := s.FindLegacyTracks(ctx)
+	if err != nil {
+		return err
+	}
+	if len(tracks) == 0 {
+		return nil
+	}
+	fmt.Printf("Migrating %d tracks...\n", len(tracks))
+
+	var files map[string][]string
+	if slices.ContainsFunc(tracks, func(t *storage.Metadata) bool { return t.Folder == "" }) {
+		if files, err = opts.Library.Files(); err != nil {
+			return err
+		}
+	}
+
+	// ids maps the old identifiers of the tracks in each folder to their new
+	// ones.
+	ids := map[string]map[string]string{}
+	skipped := 0
+	for _, t := range tracks {
+		oldId := t.Id
+		if err := migrateTrack(ctx, s, opts, t, files); err != nil {
+			fmt.Printf("WARNING: unable to migrate %s: %v\n", oldId, err)
+			skipped++
+			continue
+		}
+		if ids[t.Folder] == nil {
+			ids[t.Folder] = map[string]string{}
+		}
+		ids[t.Folder][oldId] = t.Id
+	}
+
+	for folder, folderIds := range ids {
+		if err := renameShowTracks(ctx, s, folder, folderIds); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Migrated %d tracks, skipped %d\n", len(tracks)-skipped, skipped)
+	if skipped > 0 {
+		return fmt.Errorf("unable to migrate %d tracks", skipped)
+	}
+	return nil
+}
+
+// migrateTrack gives t its new identifier. files maps filenames to their
+// paths in the library roots, for tracks saved without a folder.
+func migrateTrack(ctx context.Context, s storage.Handler, opts *Options, t *storage.Metadata, files map[string][]string) error {
+	if t.Folder == "" {
+		folder, err := legacyFolder(t, opts.Library, files[t.Filename])
+		if err != nil {
+			return err
+		}
+		t.Folder = folder
+	}
+	path := filepath.Join(t.Folder, t.Filename)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	oldId := t.Id
+	t.Path = path
+	t.LibraryRoot, t.RelPath = opts.Library.RelPath(path, "")
+	format, err := opts.Audio.Detect(f, path)
+	if err != nil {
+		return err
+	}
+	if t.ContentHash, err = library.ContentHash(f, format, path); err != nil {
+		return err
+	}
+	if sum, ok := strings.CutPrefix(t.ContentHash, "md5:"); ok {
+		t.AudioMD5 = sum
+	}
+	t.Id = library.TrackId(t.LibraryRoot, t.RelPath, t.ContentHash)
+
+	if _, err := s.SaveMetadata(ctx, t); err != nil {
+		return err
+	}
+	return s.DeleteTrack(ctx, oldId)
+}
+
+// legacyFolder returns the folder holding a track saved without one, out of
+// the paths in the library roots with its filename. When there are several,
+// the one in a folder named after the track's album is used.
+func legacyFolder(t *storage.Metadata, l *library.Library, paths []string) (string, error) {
+	switch len(paths) {
+	case 0:
+		if len(l.Roots()) == 0 {
+			return "", fmt.Errorf("no folder recorded for %s; give the --library_root it's in", t.Filename)
+		}
+		return "", fmt.Errorf("%s not found in the library roots", t.Filename)
+	case 1:
+		return filepath.Dir(paths[0]), nil
+	}
+
+	var matches []string
+	for _, p := range paths {
+		if t.Album != "" && strings.EqualFold(filepath.Base(filepath.Dir(p)), t.Album) {
+			matches = append(matches, p)
+		}
+	}
+	if len(matches) != 1 {
+		return "", fmt.Errorf("%d files called %s in the library roots", len(paths), t.Filename)
+	}
+	return filepath.Dir(matches[0]), nil
+}
+
+// renameShowTracks replaces the old track identifiers in the shows of a folder
+// with the new ones in ids.
+func renameShowTracks(ctx context.Context, s storage.Handler, folder string, ids map[string]string) error {
+	shows, err := s.FindShowsByFolder(ctx, folder)
+	if err != nil || len(shows) == 0 {
+		return err
+	}
+	for _, show := range shows {
+		for i := range show.Discs {
+			for j := range show.Discs[i].Sets {
+				tracks := show.Discs[i].Sets[j].Tracks
+				for k := range tracks {
+					if id, ok := ids[tracks[k].TrackId]; ok {
+						tracks[k].TrackId = id
+					}
+				}
+			}
+		}
+	}
+	return s.ReplaceShows(ctx, folder, shows)
+}
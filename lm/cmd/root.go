@@ -1,15 +1,29 @@
 package cmd
 
 import (
+	"cmp"
+	"os"
+
 	"github.com/organicveggie/livemusic/lm/cmd/analyze"
+	"github.com/organicveggie/livemusic/lm/cmd/db"
 	"github.com/organicveggie/livemusic/lm/cmd/scan"
+	"github.com/organicveggie/livemusic/lm/cmd/verify"
+	"github.com/organicveggie/livemusic/lm/config"
 	"github.com/spf13/cobra"
 )
 
 var (
+	configFile string
+	profile    string
+
 	rootCmd = &cobra.Command{
 		Use:   "lm",
 		Short: "Live Music manager",
+
+		PersistentPreRunE: loadConfig,
+
+		// main prints the error returned by Execute
+		SilenceErrors: true,
 	}
 )
 
@@ -19,6 +33,31 @@ func Execute() error {
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "Config file (default "+config.DefaultPath()+")")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "Config file profile to use (default is the config's default_profile)")
+
 	rootCmd.AddCommand(scan.Cmd)
 	rootCmd.AddCommand(analyze.Cmd)
+	rootCmd.AddCommand(verify.Cmd)
+	rootCmd.AddCommand(db.Cmd)
+}
+
+// loadConfig fills in the flags of the command being run that weren't given
+// on the command line from the environment and the config file.
+func loadConfig(cmd *cobra.Command, args []string) error {
+	filename := cmp.Or(configFile, os.Getenv(config.EnvPrefix+"CONFIG"))
+	required := filename != ""
+	if !required {
+		filename = config.DefaultPath()
+	}
+
+	c, err := config.Load(filename, required)
+	if err != nil {
+		return err
+	}
+	p, err := c.Profile(cmp.Or(profile, os.Getenv(config.EnvPrefix+"PROFILE")))
+	if err != nil {
+		return err
+	}
+	return config.Apply(cmd.Name(), cmd.Flags(), p, args)
 }
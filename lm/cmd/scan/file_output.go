@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"io/fs"
 	"os"
+
+	"github.com/organicveggie/livemusic/lm/message"
 )
 
 type FileAddFileOut struct {
@@ -35,17 +37,30 @@ func newFileAddFileOut(filename string, overwrite bool) (*FileAddFileOut, error)
 	return fileOut, nil
 }
 
-func (f *FileAddFileOut) Close() error {
+func (f *FileAddFileOut) Flush() error {
 	if err := f.writer.Flush(); err != nil {
 		return fmt.Errorf("error flushing output file %s: %v", f.filename, err)
 	}
+	return nil
+}
+
+func (f *FileAddFileOut) Close() error {
+	if err := f.Flush(); err != nil {
+		return err
+	}
 	if err := f.file.Close(); err != nil {
 		return fmt.Errorf("error closing output file %s: %v", f.filename, err)
 	}
 	return nil
 }
 
-func (f *FileAddFileOut) AddFile(filename string) error {
-	fmt.Fprintf(f.writer, "%s\n", filename)
+func (f *FileAddFileOut) AddFile(file *message.File) error {
+	body, err := message.Encode(file)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(f.writer, "%s\n", body); err != nil {
+		return fmt.Errorf("error writing output file %s: %v", f.filename, err)
+	}
 	return nil
 }
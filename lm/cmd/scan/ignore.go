@@ -0,0 +1,303 @@
+package scan
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ignoreFilename is the name of the files holding gitignore style patterns
+// of files and folders for scan to skip. The patterns in a file apply to the
+// folder it's in and the folders below it.
+const ignoreFilename = ".lmignore"
+
+// ignoreRule is a gitignore style pattern.
+type ignoreRule struct {
+	// pattern is the pattern as written, and source is where it came from,
+	// for the skip summary.
+	pattern string
+	source  string
+	// base is the folder that the pattern is relative to.
+	base string
+
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// newIgnoreRule parses a line of an ignore file, returning nil for blank
+// lines and comments.
+func newIgnoreRule(line, base, source string) (*ignoreRule, error) {
+	// Trailing spaces are ignored unless escaped
+	if trimmed := strings.TrimRight(line, " \t"); !strings.HasSuffix(trimmed, `\`) {
+		line = trimmed
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, nil
+	}
+
+	r := &ignoreRule{pattern: line, source: source, base: base}
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+
+	// Patterns with a slash before the end are relative to the base, others
+	// match at any depth.
+	prefix := "^(?:.*/)?"
+	if strings.Contains(line, "/") {
+		prefix = "^"
+		line = strings.TrimPrefix(line, "/")
+	}
+
+	re, err := regexp.Compile(prefix + globToRegexp(line) + "$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid ignore pattern %q in %s: %v", r.pattern, source, err)
+	}
+	r.re = re
+	return r, nil
+}
+
+// globToRegexp converts a gitignore glob to a regular expression.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/") && (i == 0 || glob[i-1] == '/'):
+			// Any number of folders, including none
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**") && i+2 == len(glob) && (i == 0 || glob[i-1] == '/'):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	return b.String()
+}
+
+// matches reports whether the rule matches path, which is within its base.
+func (r *ignoreRule) matches(path string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	rel, err := filepath.Rel(r.base, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	return r.re.MatchString(filepath.ToSlash(rel))
+}
+
+// ignorer decides which files and folders a scan skips, using the ignore
+// files in the scan roots, the global exclude patterns, and a minimum size
+// for audio files.
+type ignorer struct {
+	roots    []string
+	excludes []string
+	minSize  byteSize
+
+	// rules caches the rules that apply to the entries of each folder
+	rules map[string][]*ignoreRule
+}
+
+func newIgnorer(roots, excludes []string, minSize byteSize) (*ignorer, error) {
+	// Check the patterns up front, rather than when they're first used
+	for _, pattern := range excludes {
+		if _, err := newIgnoreRule(pattern, "", "--exclude"); err != nil {
+			return nil, err
+		}
+	}
+	return &ignorer{roots: roots, excludes: excludes, minSize: minSize, rules: map[string][]*ignoreRule{}}, nil
+}
+
+// reset forgets the cached rules, after an ignore file changed.
+func (ig *ignorer) reset() {
+	clear(ig.rules)
+}
+
+// rulesFor returns the rules that apply to the entries of dir, in the order
+// they're checked. Rules from deeper ignore files come later, so they win.
+func (ig *ignorer) rulesFor(dir string) []*ignoreRule {
+	if rules, ok := ig.rules[dir]; ok {
+		return rules
+	}
+
+	var rules []*ignoreRule
+	if parent := filepath.Dir(dir); slices.Contains(ig.roots, dir) || parent == dir {
+		for _, pattern := range ig.excludes {
+			if r, _ := newIgnoreRule(pattern, dir, "--exclude"); r != nil {
+				rules = append(rules, r)
+			}
+		}
+	} else {
+		rules = slices.Clone(ig.rulesFor(parent))
+	}
+
+	filename := filepath.Join(dir, ignoreFilename)
+	if f, err := os.Open(filename); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			r, err := newIgnoreRule(scanner.Text(), dir, filename)
+			if err != nil {
+				fmt.Printf("WARNING: %v\n", err)
+				continue
+			}
+			if r != nil {
+				rules = append(rules, r)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			fmt.Printf("WARNING: error reading %s: %v\n", filename, err)
+		}
+		f.Close()
+	}
+
+	ig.rules[dir] = rules
+	return rules
+}
+
+// skip returns why path should be skipped, or "" if it shouldn't be. size
+// is only checked for audio files.
+func (ig *ignorer) skip(path string, isDir bool, size int64) string {
+	rules := ig.rulesFor(filepath.Dir(path))
+	for i := len(rules) - 1; i >= 0; i-- {
+		r := rules[i]
+		if !r.matches(path, isDir) {
+			continue
+		}
+		if r.negate {
+			break
+		}
+		return fmt.Sprintf("matching %q in %s", r.pattern, r.source)
+	}
+
+	if !isDir && ig.minSize > 0 && size < int64(ig.minSize) && cfg.audio.ForFile(path) != nil {
+		return fmt.Sprintf("smaller than %v", &ig.minSize)
+	}
+	return ""
+}
+
+// skipTree returns why dir, or one of the folders above it within a scan
+// root, should be skipped, or "" if none of them should be.
+func (ig *ignorer) skipTree(dir string) string {
+	for path := dir; !slices.Contains(ig.roots, path) && filepath.Dir(path) != path; path = filepath.Dir(path) {
+		if reason := ig.skip(path, true, 0); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+// skipSummary counts the files and folders that were skipped, by reason.
+type skipSummary struct {
+	files   map[string]int
+	folders map[string]int
+}
+
+func newSkipSummary() *skipSummary {
+	return &skipSummary{files: map[string]int{}, folders: map[string]int{}}
+}
+
+// add counts a skipped file or folder. It does nothing if s is nil.
+func (s *skipSummary) add(reason string, isDir bool) {
+	if s == nil {
+		return
+	}
+	if isDir {
+		s.folders[reason]++
+	} else {
+		s.files[reason]++
+	}
+}
+
+func (s *skipSummary) print() {
+	files, folders := 0, 0
+	for _, n := range s.files {
+		files += n
+	}
+	for _, n := range s.folders {
+		folders += n
+	}
+	if files == 0 && folders == 0 {
+		return
+	}
+
+	fmt.Printf("Skipped %d files and %d folders:\n", files, folders)
+	for _, reason := range slices.Sorted(maps.Keys(s.folders)) {
+		fmt.Printf("  %d folders %s\n", s.folders[reason], reason)
+	}
+	for _, reason := range slices.Sorted(maps.Keys(s.files)) {
+		fmt.Printf("  %d files %s\n", s.files[reason], reason)
+	}
+}
+
+// byteSize is a number of bytes, which can be given with a K, M, or G
+// suffix for KiB, MiB, or GiB.
+type byteSize int64
+
+var byteSizeRegEx = regexp.MustCompile(`(?i)^\s*(\d+)\s*([kmg]?)i?b?\s*$`)
+
+// String is used both by fmt.Print and by Cobra in help text
+func (s *byteSize) String() string {
+	n := int64(*s)
+	for i, unit := range []string{"G", "M", "K"} {
+		size := int64(1) << (10 * (3 - i))
+		if n >= size && n%size == 0 {
+			return fmt.Sprintf("%d%s", n/size, unit)
+		}
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+// Set must have pointer receiver so it doesn't change the value of a copy
+func (s *byteSize) Set(v string) error {
+	m := byteSizeRegEx.FindStringSubmatch(v)
+	if m == nil {
+		return fmt.Errorf(`must be a number of bytes, optionally followed by K, M, or G, such as "512K"`)
+	}
+	n, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return err
+	}
+	if m[2] != "" {
+		n <<= 10 * (strings.Index("KMG", strings.ToUpper(m[2])) + 1)
+	}
+	*s = byteSize(n)
+	return nil
+}
+
+// Type is only used in help text
+func (s *byteSize) Type() string {
+	return "byteSize"
+}
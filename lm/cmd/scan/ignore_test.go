@@ -0,0 +1,122 @@
+package scan
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreRule(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		{"*.log", "/music/show/eac.log", false, true},
+		{"*.log", "/music/show/eac.logs", false, false},
+		{"._*", "/music/show/._d1t01.flac", false, true},
+		{"sample/", "/music/show/sample", true, true},
+		{"sample/", "/music/show/sample", false, false},
+		{"/sample", "/music/show/sample", true, false},
+		{"/show/sample", "/music/show/sample", true, true},
+		{"show/*.txt", "/music/show/info.txt", false, true},
+		{"show/*.txt", "/music/show/d1/info.txt", false, false},
+		{"**/d1", "/music/show/d1", true, true},
+		{"show/**", "/music/show/d1/t01.flac", false, true},
+		{"show/**/t01.flac", "/music/show/t01.flac", false, true},
+		{"t0?.flac", "/music/show/t01.flac", false, true},
+		{"t0?.flac", "/music/show/t010.flac", false, false},
+		{"t0[12].flac", "/music/show/t02.flac", false, true},
+		{"t0[!12].flac", "/music/show/t02.flac", false, false},
+		{`\#1.flac`, "/music/show/#1.flac", false, true},
+		{"*.flac", "/other/t01.flac", false, false},
+	}
+	for _, tt := range tests {
+		r, err := newIgnoreRule(tt.pattern, "/music", "test")
+		if err != nil {
+			t.Fatalf("newIgnoreRule(%q) error = %v", tt.pattern, err)
+		}
+		if got := r.matches(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("%q matches %s = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestIgnoreRuleBlank(t *testing.T) {
+	for _, line := range []string{"", "   ", "# comment"} {
+		if r, err := newIgnoreRule(line, "/music", "test"); r != nil || err != nil {
+			t.Errorf("newIgnoreRule(%q) = %v, %v, want nil, nil", line, r, err)
+		}
+	}
+}
+
+func TestIgnorerSkip(t *testing.T) {
+	root := t.TempDir()
+	show := filepath.Join(root, "show")
+	if err := os.MkdirAll(show, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// The show's ignore file re-includes a file the root's excludes skip
+	if err := os.WriteFile(filepath.Join(show, ignoreFilename), []byte("# keep the notes\n!notes.log\nsample/\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ig, err := newIgnorer([]string{root}, []string{"*.log"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path  string
+		isDir bool
+		skip  bool
+	}{
+		{filepath.Join(root, "eac.log"), false, true},
+		{filepath.Join(show, "eac.log"), false, true},
+		{filepath.Join(show, "notes.log"), false, false},
+		{filepath.Join(show, "sample"), true, true},
+		{filepath.Join(show, "d1t01.flac"), false, false},
+	}
+	for _, tt := range tests {
+		if got := ig.skip(tt.path, tt.isDir, 0); (got != "") != tt.skip {
+			t.Errorf("skip(%s) = %q, want skipped %v", tt.path, got, tt.skip)
+		}
+	}
+	if got := ig.skipTree(filepath.Join(show, "sample", "d1")); got == "" {
+		t.Error("skipTree() below an ignored folder = \"\", want a reason")
+	}
+}
+
+func TestNewIgnorerInvalid(t *testing.T) {
+	if _, err := newIgnorer(nil, []string{"[z-a]"}, 0); err == nil {
+		t.Error("newIgnorer() error = nil, want an error for an invalid pattern")
+	}
+}
+
+func TestByteSize(t *testing.T) {
+	tests := []struct {
+		value string
+		want  byteSize
+		str   string
+	}{
+		{"512", 512, "512"},
+		{"512K", 512 << 10, "512K"},
+		{"1m", 1 << 20, "1M"},
+		{"2GiB", 2 << 30, "2G"},
+		{"1536K", 1536 << 10, "1536K"},
+	}
+	for _, tt := range tests {
+		var s byteSize
+		if err := s.Set(tt.value); err != nil {
+			t.Fatalf("Set(%q) error = %v", tt.value, err)
+		}
+		if s != tt.want || s.String() != tt.str {
+			t.Errorf("Set(%q) = %d (%s), want %d (%s)", tt.value, s, s.String(), tt.want, tt.str)
+		}
+	}
+
+	var s byteSize
+	if err := s.Set("lots"); err == nil {
+		t.Error(`Set("lots") error = nil, want an error`)
+	}
+}
@@ -0,0 +1,57 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/organicveggie/livemusic/lm/message"
+	"github.com/organicveggie/livemusic/lm/mongoqueue"
+)
+
+// mongoBatchSize is the number of messages added to the queue at a time.
+const mongoBatchSize = 1000
+
+// MongoQueueOut sends files to a work queue stored in MongoDB.
+type MongoQueueOut struct {
+	queue  *mongoqueue.Queue
+	bodies []string
+	sent   int
+}
+
+func newMongoQueueOut(mongoURI, queueName string) (*MongoQueueOut, error) {
+	queue, err := mongoqueue.Open(context.Background(), mongoURI, queueName)
+	if err != nil {
+		return nil, err
+	}
+	return &MongoQueueOut{queue: queue}, nil
+}
+
+func (q *MongoQueueOut) AddFile(f *message.File) error {
+	body, err := message.Encode(f)
+	if err != nil {
+		return err
+	}
+	q.bodies = append(q.bodies, body)
+	if len(q.bodies) < mongoBatchSize {
+		return nil
+	}
+	return q.Flush()
+}
+
+func (q *MongoQueueOut) Flush() error {
+	if err := q.queue.Push(context.Background(), q.bodies); err != nil {
+		return err
+	}
+	q.sent += len(q.bodies)
+	q.bodies = nil
+	return nil
+}
+
+func (q *MongoQueueOut) Close() error {
+	err := q.Flush()
+	fmt.Printf("Sent %d messages to %s\n", q.sent, q.queue.Name())
+	if cerr := q.queue.Close(context.Background()); err == nil && cerr != nil {
+		err = fmt.Errorf("error disconnecting from MongoDB: %v", cerr)
+	}
+	return err
+}
@@ -6,6 +6,7 @@ type outputFormat string
 
 const (
 	outputFile   outputFormat = "file"
+	outputMongo  outputFormat = "mongo"
 	outputQueue  outputFormat = "queue"
 	outputStdOut outputFormat = "stdout"
 )
@@ -18,11 +19,11 @@ func (e *outputFormat) String() string {
 // Set must have pointer receiver so it doesn't change the value of a copy
 func (e *outputFormat) Set(v string) error {
 	switch v {
-	case "file", "queue", "stdout":
+	case "file", "mongo", "queue", "stdout":
 		*e = outputFormat(v)
 		return nil
 	default:
-		return errors.New(`must be one of "file", "queue", or "stdout"`)
+		return errors.New(`must be one of "file", "mongo", "queue", or "stdout"`)
 	}
 }
 
@@ -1,45 +1,113 @@
 package scan
 
 import (
+	"cmp"
+	"crypto/rand"
 	"fmt"
 	"io/fs"
 	"maps"
 	"os"
 	"path/filepath"
-	"regexp"
 	"slices"
+	"strings"
+	"time"
 
+	"github.com/organicveggie/livemusic/lm/archive"
+	"github.com/organicveggie/livemusic/lm/audio/formats"
+	sqsh "github.com/organicveggie/livemusic/lm/aws/sqs"
+	"github.com/organicveggie/livemusic/lm/etree"
+	"github.com/organicveggie/livemusic/lm/message"
 	"github.com/spf13/cobra"
 )
 
 type commandConfig struct {
-	filename  string
-	format    outputFormat
-	overwrite bool
-	queueName string
-	recursive bool
+	filename       string
+	format         outputFormat
+	libraryRoots   []string
+	mongoURI       string
+	overwrite      bool
+	queueName      string
+	recursive      bool
+	maxDepth       int
+	followSymlinks bool
+	oneFileSystem  bool
+	archives       bool
+	senders        int
+	stateFile      string
+	full           bool
+	hash           bool
+	watch          bool
+	settle         time.Duration
+	formats        []string
+	skipFormats    []string
+	excludes       []string
+	minSize        byteSize
 
-	awsProfile string
+	// audio is the registry of the enabled formats, set by checkFlags
+	audio *formats.Registry
+
+	awsProfile  string
+	region      string
+	sqsEndpoint string
+}
+
+// stateOutput returns the name of the output that the scan state is kept
+// for: the output format and the queue or file that files are sent to.
+func (c *commandConfig) stateOutput() string {
+	switch c.format {
+	case outputFile:
+		filename := c.filename
+		if abs, err := filepath.Abs(filename); err == nil {
+			filename = abs
+		}
+		return fmt.Sprintf("%s:%s", c.format, filename)
+	case outputMongo, outputQueue:
+		return fmt.Sprintf("%s:%s", c.format, c.queueName)
+	default:
+		return string(c.format)
+	}
 }
 
 func (c *commandConfig) checkFlags() error {
+	if c.maxDepth < -1 {
+		return fmt.Errorf("--max_depth must be -1 for no limit, or at least 0")
+	}
+	if !c.recursive {
+		c.maxDepth = 0
+	}
 	if c.format == outputFile && len(c.filename) == 0 {
 		return fmt.Errorf("missing required flag --filename")
 	}
 	if c.format == outputQueue && c.queueName == "" {
 		return fmt.Errorf("missing required AWS SQS queue name")
 	}
-	return nil
+	if c.format == outputMongo {
+		c.mongoURI = cmp.Or(c.mongoURI, os.Getenv("MONGODB_URI"))
+		if c.mongoURI == "" {
+			return fmt.Errorf("missing required MongoDB connection string")
+		}
+	}
+	if c.watch && c.settle <= 0 {
+		return fmt.Errorf("--settle must be positive")
+	}
+	if c.format == outputQueue && c.senders < 1 {
+		return fmt.Errorf("--senders must be at least 1")
+	}
+
+	var err error
+	c.audio, err = formats.New(c.formats, c.skipFormats)
+	return err
 }
 
 var (
 	cfg commandConfig
 
 	Cmd = &cobra.Command{
-		Use:   "scan [folder] {folder2 ... folderN}",
-		Short: "Scan folders for music",
-		Args:  cobra.MinimumNArgs(1),
-		RunE:  scan,
+		Use:          "scan [folder] {folder2 ... folderN}",
+		Short:        "Scan folders for music",
+		Args:         cobra.MinimumNArgs(1),
+		RunE:         scan,
+		SilenceUsage: true,
 	}
 )
 
@@ -48,17 +116,39 @@ func init() {
 	cfg.format = outputStdOut
 	cfg.overwrite = false
 	cfg.recursive = true
+	cfg.archives = true
 
 	Cmd.Flags().StringVarP(&cfg.awsProfile, "aws_profile", "a", "", "Name of the AWS profile to use")
+	Cmd.Flags().StringVar(&cfg.region, "region", sqsh.DefaultRegion, "AWS region of the SQS queue")
+	Cmd.Flags().StringVar(&cfg.sqsEndpoint, "sqs_endpoint", "", "Custom SQS endpoint, such as an ElasticMQ or LocalStack server")
 	Cmd.Flags().StringVarP(&cfg.filename, "filename", "f", "", "Name output file")
-	Cmd.Flags().BoolVarP(&cfg.recursive, "recursive", "r", false, "Recursively process subfolders")
-	Cmd.Flags().VarP(&cfg.format, "output_format", "o", `Output format type: "file", "queue", "stdout".`)
+	Cmd.Flags().StringSliceVar(&cfg.formats, "formats", nil, fmt.Sprintf("Audio formats to scan for, or all of them if empty: %s", strings.Join(formats.Names(), ",")))
+	Cmd.Flags().StringSliceVar(&cfg.skipFormats, "skip_formats", nil, "Audio formats not to scan for")
+	Cmd.Flags().BoolVar(&cfg.archives, "archives", cfg.archives, "Scan the media files inside zip and tar archives, which are sent with paths like show.zip!/show/track.flac")
+	Cmd.Flags().StringSliceVar(&cfg.excludes, "exclude", []string{"._*", "@eaDir/"}, "gitignore style patterns of files and folders to skip in every scan root, in addition to those in "+ignoreFilename+" files")
+	Cmd.Flags().Var(&cfg.minSize, "min_size", `Skip audio files smaller than this, such as "512K"`)
+	Cmd.Flags().BoolVar(&cfg.full, "full", false, "Send every file, not just the ones that are new or changed since the last scan")
+	Cmd.Flags().BoolVar(&cfg.hash, "hash", false, "Hash files, so that files whose modification time changed but content didn't aren't sent again")
+	Cmd.Flags().StringSliceVarP(&cfg.libraryRoots, "library_root", "l", nil, "Library root folders to include in messages, so analyze can store paths relative to them")
+	Cmd.Flags().BoolVarP(&cfg.recursive, "recursive", "r", cfg.recursive, "Recursively process subfolders, or only the files directly within the scan roots with --recursive=false")
+	Cmd.Flags().IntVar(&cfg.maxDepth, "max_depth", -1, "How many levels of subfolders to process below each scan root, or -1 for no limit")
+	Cmd.Flags().BoolVar(&cfg.followSymlinks, "follow_symlinks", false, "Follow symbolic links to files and folders, skipping links that loop back to a folder above them")
+	Cmd.Flags().BoolVar(&cfg.oneFileSystem, "one_file_system", false, "Skip subfolders on a different file system from their scan root, such as network mounts")
+	Cmd.Flags().StringVarP(&cfg.mongoURI, "mongodb_uri", "m", "", "MongoDB connection string for the mongo output format")
+	Cmd.Flags().VarP(&cfg.format, "output_format", "o", `Output format type: "file", "mongo", "queue", "stdout".`)
 	Cmd.Flags().BoolVarP(&cfg.overwrite, "overwrite", "w", false, "Overwrite existing destination file")
-	Cmd.Flags().StringVarP(&cfg.queueName, "queue_name", "q", "live-music", "Name of destination queue")
+	Cmd.Flags().StringVarP(&cfg.queueName, "queue_name", "q", "live-music", "Name of destination SQS or MongoDB queue")
+	Cmd.Flags().IntVar(&cfg.senders, "senders", 4, "Number of batches of queue messages to send concurrently")
+	Cmd.Flags().BoolVar(&cfg.watch, "watch", false, "Keep running after the scan, sending files as they're added, changed, or removed")
+	Cmd.Flags().DurationVar(&cfg.settle, "settle", 30*time.Second, "How long a folder must go without changes before --watch sends its files, so that copies can finish")
+	Cmd.Flags().StringVar(&cfg.stateFile, "state_file", "", "Database of the files sent to each output by previous scans, so that only new, changed, and removed files are sent, such as "+defaultStatePath())
 }
 
 type FileAddOp interface {
-	AddFile(filename string) error
+	AddFile(f *message.File) error
+	// Flush sends any files that are buffered, returning an error if any of
+	// them couldn't be sent.
+	Flush() error
 	Close() error
 }
 
@@ -67,40 +157,250 @@ func scan(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	files, err := findFiles(args)
+	folders := []string{}
+	for _, folder := range args {
+		if abs, err := filepath.Abs(folder); err == nil {
+			folder = abs
+		}
+		folders = append(folders, filepath.Clean(folder))
+	}
+
+	r := &scanRun{folders: folders, walk: newWalker(cfg.maxDepth, cfg.followSymlinks, cfg.oneFileSystem)}
+	var err error
+	if r.ignore, err = newIgnorer(folders, cfg.excludes, cfg.minSize); err != nil {
+		return err
+	}
+
+	files, err := r.findFiles(folders)
 	if err != nil {
 		return err
 	}
 	fmt.Printf("Found %d files\n", len(files))
 
-	var output FileAddOp
+	r.host, _ = os.Hostname()
+	if r.scanId, err = newScanId(); err != nil {
+		return err
+	}
+
+	prev := map[string]*fileState{}
+	if cfg.stateFile != "" {
+		if r.state, err = openScanState(cfg.stateFile, cfg.stateOutput()); err != nil {
+			return err
+		}
+		defer r.state.Close()
+		if prev, err = r.state.load(folders); err != nil {
+			return err
+		}
+		maps.DeleteFunc(prev, r.excluded)
+	}
+
 	switch cfg.format {
 	case outputFile:
-		output, err = newFileAddFileOut(cfg.filename, cfg.overwrite)
+		r.output, err = newFileAddFileOut(cfg.filename, cfg.overwrite)
+	case outputMongo:
+		fmt.Println("Setting up MongoDB queue...")
+		r.output, err = newMongoQueueOut(cfg.mongoURI, cfg.queueName)
 	case outputQueue:
 		fmt.Println("Setting up AWS SQS connection...")
-		output, err = newQueueOut(cfg.awsProfile, cfg.queueName)
+		r.output, err = newQueueOut(sqsh.Settings{Profile: cfg.awsProfile, Region: cfg.region, Endpoint: cfg.sqsEndpoint}, cfg.queueName, cfg.senders)
 	default:
-		output = newFileAddStdOut()
+		r.output = newFileAddStdOut()
 	}
 	if err != nil {
 		return err
 	}
-	defer output.Close()
 
-	for _, k := range slices.Sorted(maps.Keys(files)) {
-		output.AddFile(k)
+	err = r.emit(prev, files)
+	if err == nil && cfg.watch {
+		err = r.watch(cmd.Context(), folders)
+	}
+	if cerr := r.output.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
 	}
 	fmt.Println("Done")
 
 	return nil
 }
 
-func findFiles(args []string) (map[string]bool, error) {
-	mediaMatch := regexp.MustCompile(`[.](shn|flac|mp3)$`)
+// scanRun sends the files found by a scan to its output.
+type scanRun struct {
+	// folders are the absolute scan roots
+	folders []string
+	output  FileAddOp
+	// state is nil when every file is sent.
+	state  *scanState
+	ignore *ignorer
+	walk   *walker
+	host   string
+	scanId string
+}
 
-	files := map[string]bool{}
-	for _, folder := range args {
+// excluded reports whether the file at path, which a previous scan found,
+// was left out of this one on purpose, by the formats, ignore rules, minimum
+// size, or walking options, or because its folder or archive couldn't be
+// read. Such files aren't known to be removed, so they're dropped from the
+// previous state rather than sent as removed.
+func (r *scanRun) excluded(path string, prev *fileState) bool {
+	filePath := path
+	if archivePath, _, ok := archive.Split(path); ok {
+		if !cfg.archives || r.ignore.skip(archivePath, false, 0) != "" {
+			return true
+		}
+		filePath = archivePath
+	}
+	if !isMedia(path) || inFolders(filePath, r.walk.unscanned) {
+		return true
+	}
+	if r.ignore.skip(path, false, prev.size) != "" || r.ignore.skipTree(filepath.Dir(path)) != "" {
+		return true
+	}
+	return r.walk.tooDeep(r.folders, filepath.Dir(filePath)) || r.walk.throughLink(r.folders, filePath)
+}
+
+// emit sends the new and changed files, and the files in prev that weren't
+// found, which have been removed. prev is the state of the folders that files
+// were found in.
+func (r *scanRun) emit(prev map[string]*fileState, files map[string]fs.FileInfo) error {
+	found := []*message.File{}
+	updates := []*fileState{}
+	unchanged := 0
+	for _, k := range slices.Sorted(maps.Keys(files)) {
+		path := k
+		if abs, err := filepath.Abs(k); err == nil {
+			path = abs
+		}
+
+		st := &fileState{path: path, size: files[k].Size(), modTime: files[k].ModTime().UTC()}
+		p := prev[path]
+		delete(prev, path)
+		if p != nil && st.size == p.size && st.modTime.Equal(p.modTime) {
+			st.hash = p.hash
+		} else if cfg.hash {
+			var err error
+			if st.hash, err = hashFile(path); err != nil {
+				fmt.Printf("WARNING: %v\n", err)
+			}
+		}
+
+		if !st.changed(p) && !cfg.full {
+			if !st.modTime.Equal(p.modTime) {
+				// Remember the new time, so the file isn't hashed again
+				updates = append(updates, st)
+			}
+			unchanged++
+			continue
+		}
+		updates = append(updates, st)
+		found = append(found, r.newMessage(message.EventFound, st))
+	}
+
+	// Files left over were seen by a previous scan but not this one
+	removed := slices.Sorted(maps.Keys(prev))
+	for _, path := range removed {
+		found = append(found, r.newMessage(message.EventRemoved, prev[path]))
+	}
+	if r.state != nil {
+		fmt.Printf("%d new or changed, %d unchanged, %d removed\n", len(found)-len(removed), unchanged, len(removed))
+	}
+
+	for _, f := range found {
+		if err := r.output.AddFile(f); err != nil {
+			return err
+		}
+	}
+	if err := r.output.Flush(); err != nil {
+		return err
+	}
+
+	// The state is only saved once everything has been sent, so that files
+	// that failed to send are sent again by the next scan.
+	if r.state == nil {
+		return nil
+	}
+	return r.state.save(r.scanId, updates, removed)
+}
+
+func (r *scanRun) newMessage(event message.Event, st *fileState) *message.File {
+	return &message.File{
+		Event:       event,
+		Path:        st.path,
+		LibraryRoot: libraryRoot(cfg.libraryRoots, st.path),
+		Size:        st.size,
+		ModTime:     st.modTime,
+		Host:        r.host,
+		ScanId:      r.scanId,
+	}
+}
+
+// newScanId returns a random identifier for a scan run, so that the files it
+// found can be told apart from those of other runs.
+func newScanId() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating scan ID: %v", err)
+	}
+	return fmt.Sprintf("%s-%x", time.Now().UTC().Format("20060102T150405Z"), b), nil
+}
+
+// libraryRoot returns the longest of roots containing path, or "" if none
+// do.
+func libraryRoot(roots []string, path string) string {
+	best := ""
+	for _, root := range roots {
+		if abs, err := filepath.Abs(root); err == nil {
+			root = abs
+		}
+		if len(root) > len(best) && strings.HasPrefix(path, root+string(filepath.Separator)) {
+			best = root
+		}
+	}
+	return best
+}
+
+// isMedia reports whether path is a file that scan sends: audio in one of
+// the enabled formats, or an info text file.
+func isMedia(path string) bool {
+	return cfg.audio.ForFile(path) != nil || etree.IsInfoFile(path)
+}
+
+// isArchive reports whether path is an archive whose media files are
+// scanned.
+func (r *scanRun) isArchive(path string) bool {
+	return cfg.archives && archive.IsArchive(path)
+}
+
+// addArchive adds the media files in the archive at path to files.
+func (r *scanRun) addArchive(path string, files map[string]fs.FileInfo, skipped *skipSummary) {
+	entries, err := archive.List(path)
+	if err != nil {
+		fmt.Printf("WARNING: %v\n", err)
+		skipped.add("that are archives that couldn't be read", false)
+		r.walk.unscanned = append(r.walk.unscanned, path)
+		return
+	}
+	for _, e := range entries {
+		entryPath := archive.Join(path, e.Name)
+		if !isMedia(entryPath) {
+			continue
+		}
+		if reason := r.ignore.skip(entryPath, false, e.Info.Size()); reason != "" {
+			skipped.add(reason, false)
+			continue
+		}
+		files[entryPath] = e.Info
+	}
+}
+
+// findFiles returns the files to send in folders, printing a summary of the
+// ones that were skipped.
+func (r *scanRun) findFiles(folders []string) (map[string]fs.FileInfo, error) {
+	files := map[string]fs.FileInfo{}
+	skipped := newSkipSummary()
+	r.walk.unscanned = nil
+	for _, folder := range folders {
 		fmt.Printf("Processing folder %s\n", folder)
 
 		fileInfo, err := os.Stat(folder)
@@ -111,15 +411,36 @@ func findFiles(args []string) (map[string]bool, error) {
 			return nil, fmt.Errorf("invalid folder: %s", folder)
 		}
 
-		filepath.WalkDir(folder, func(path string, d fs.DirEntry, err error) error {
-			if !d.IsDir() && mediaMatch.MatchString(path) {
-				if _, exists := files[path]; !exists {
-					files[path] = true
+		err = r.walk.walk(folder, 0, skipped, func(path string, info fs.FileInfo, depth int) error {
+			if info.IsDir() {
+				if reason := r.ignore.skip(path, true, 0); reason != "" {
+					skipped.add(reason, true)
+					return filepath.SkipDir
 				}
+				return nil
 			}
+			if !isMedia(path) && !r.isArchive(path) {
+				return nil
+			}
+			if _, exists := files[path]; exists {
+				return nil
+			}
+			if reason := r.ignore.skip(path, false, info.Size()); reason != "" {
+				skipped.add(reason, false)
+				return nil
+			}
+			if r.isArchive(path) {
+				r.addArchive(path, files, skipped)
+				return nil
+			}
+			files[path] = info
 			return nil
 		})
+		if err != nil {
+			return nil, fmt.Errorf("error scanning folder %s: %v", folder, err)
+		}
 	}
 
+	skipped.print()
 	return files, nil
 }
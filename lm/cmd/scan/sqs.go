@@ -1,53 +1,61 @@
 package scan
 
 import (
+	"cmp"
+	"context"
 	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sqs"
 
 	sqsh "github.com/organicveggie/livemusic/lm/aws/sqs"
+	"github.com/organicveggie/livemusic/lm/message"
+	"golang.org/x/sync/errgroup"
 )
 
+const (
+	// maxBatchSize is the most messages SendMessageBatch accepts.
+	maxBatchSize = 10
+	maxRetries   = 5
+)
+
+// QueueOut sends files to an SQS queue in batches, using several concurrent
+// senders.
 type QueueOut struct {
 	queueName string
 	queueURL  string
 
 	session *session.Session
 	sqsSvc  *sqs.SQS
+
+	batch    []*sqs.SendMessageBatchRequestEntry
+	batches  chan []*sqs.SendMessageBatchRequestEntry
+	senders  *errgroup.Group
+	ctx      context.Context
+	inflight sync.WaitGroup
+	err      error
+	errOnce  sync.Once
+
+	sent   atomic.Int64
+	failed atomic.Int64
+	// flushedFailed is the number of failed messages already reported by
+	// Flush.
+	flushedFailed int64
 }
 
-func newQueueOut(profile, queueName string) (*QueueOut, error) {
+func newQueueOut(settings sqsh.Settings, queueName string, senders int) (*QueueOut, error) {
 	q := &QueueOut{
 		queueName: queueName,
 	}
 
-	profileName := profile
-	if profile == "" {
-		profileName = "default"
-	}
-
-	// Create the AWS session
 	var err error
-	q.session, err = session.NewSessionWithOptions(session.Options{
-		// Specify profile to load for the session's config
-		Profile: profileName,
-
-		// Provide SDK Config options, such as Region.
-		Config: aws.Config{
-			Region: aws.String("us-west-2"),
-		},
-
-		// Force enable Shared Config support
-		SharedConfigState: session.SharedConfigEnable,
-	})
-
-	if err != nil {
-		return nil, fmt.Errorf("error creating AWS session: %v", err)
-	}
-	if _, err = q.session.Config.Credentials.Get(); err != nil {
-		return nil, fmt.Errorf("error loading AWS credentials: %v", err)
+	if q.session, err = sqsh.NewSession(settings); err != nil {
+		return nil, err
 	}
 
 	// Create the SQS client
@@ -58,23 +66,127 @@ func newQueueOut(profile, queueName string) (*QueueOut, error) {
 		return nil, err
 	}
 
+	q.start(senders)
 	return q, nil
 }
 
+// start starts the senders, which stop at the first error other than a
+// message failing to send.
+func (q *QueueOut) start(senders int) {
+	q.batches = make(chan []*sqs.SendMessageBatchRequestEntry)
+	q.senders, q.ctx = errgroup.WithContext(context.Background())
+	for range senders {
+		q.senders.Go(func() error {
+			for batch := range q.batches {
+				err := q.sendBatch(batch)
+				q.inflight.Done()
+				if err != nil {
+					q.errOnce.Do(func() { q.err = err })
+					return err
+				}
+			}
+			return nil
+		})
+	}
+}
+
+// Close sends any remaining files and waits for the senders to finish.
 func (q *QueueOut) Close() error {
+	err := q.Flush()
+	close(q.batches)
+	err = cmp.Or(q.senders.Wait(), err)
+
+	fmt.Printf("Sent %d messages to %s, %d failed\n", q.sent.Load(), q.queueName, q.failed.Load())
+	return err
+}
+
+func (q *QueueOut) AddFile(f *message.File) error {
+	body, err := message.Encode(f)
+	if err != nil {
+		return err
+	}
+	q.batch = append(q.batch, &sqs.SendMessageBatchRequestEntry{
+		Id:          aws.String(strconv.Itoa(len(q.batch))),
+		MessageBody: aws.String(body),
+	})
+	if len(q.batch) < maxBatchSize {
+		return nil
+	}
+	return q.handOff()
+}
+
+// Flush sends the current batch and waits for every batch handed to the
+// senders to be sent. It reports the messages that failed since the last
+// flush.
+func (q *QueueOut) Flush() error {
+	if err := q.handOff(); err != nil {
+		return err
+	}
+	q.inflight.Wait()
+	if q.ctx.Err() != nil {
+		return q.err
+	}
+
+	failed := q.failed.Load()
+	if n := failed - q.flushedFailed; n > 0 {
+		q.flushedFailed = failed
+		return fmt.Errorf("failed to send %d messages to %s", n, q.queueName)
+	}
 	return nil
 }
 
-func (q *QueueOut) AddFile(filename string) error {
-	msg := sqs.SendMessageInput{
-		MessageBody: aws.String(filename),
-		QueueUrl:    &q.queueURL,
+// handOff hands the current batch to a sender.
+func (q *QueueOut) handOff() error {
+	if len(q.batch) == 0 {
+		return nil
 	}
-	sendOutput, err := q.sqsSvc.SendMessage(&msg)
-	if err != nil {
-		return fmt.Errorf("error sending queue message for %q to %s: %v", filename, q.queueName, err)
+	q.inflight.Add(1)
+	select {
+	case q.batches <- q.batch:
+		q.batch = nil
+		return nil
+	case <-q.ctx.Done():
+		q.inflight.Done()
+		return q.err
 	}
+}
 
-	fmt.Printf("[%s]: %q\n", *sendOutput.MessageId, filename)
+// sendBatch sends a batch of messages, retrying the ones that fail for
+// reasons other than the messages themselves. Messages that still fail are
+// counted and reported, but don't stop the scan.
+func (q *QueueOut) sendBatch(entries []*sqs.SendMessageBatchRequestEntry) error {
+	for attempt := 0; len(entries) > 0; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(1<<attempt) * 100 * time.Millisecond)
+		}
+
+		out, err := q.sqsSvc.SendMessageBatchWithContext(q.ctx, &sqs.SendMessageBatchInput{
+			Entries:  entries,
+			QueueUrl: &q.queueURL,
+		})
+		if err != nil {
+			if attempt < maxRetries && q.ctx.Err() == nil {
+				continue
+			}
+			return fmt.Errorf("error sending queue messages to %s: %v", q.queueName, err)
+		}
+		q.sent.Add(int64(len(out.Successful)))
+
+		byId := map[string]*sqs.SendMessageBatchRequestEntry{}
+		for _, e := range entries {
+			byId[*e.Id] = e
+		}
+		retry := []*sqs.SendMessageBatchRequestEntry{}
+		for _, f := range out.Failed {
+			if aws.BoolValue(f.SenderFault) || attempt == maxRetries {
+				fmt.Printf("ERROR: unable to send %s to %s: %s: %s\n",
+					aws.StringValue(byId[*f.Id].MessageBody), q.queueName, aws.StringValue(f.Code), aws.StringValue(f.Message))
+				q.failed.Add(1)
+				continue
+			}
+			retry = append(retry, byId[*f.Id])
+		}
+		entries = retry
+	}
 	return nil
 }
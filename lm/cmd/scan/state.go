@@ -0,0 +1,221 @@
+package scan
+
+import (
+	"crypto/sha1"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/organicveggie/livemusic/lm/archive"
+	_ "modernc.org/sqlite"
+)
+
+// stateSchema keeps the files seen by each output apart, so that scanning to
+// one output, such as stdout to preview a scan, doesn't stop the files from
+// being sent to another.
+const stateSchema = `
+CREATE TABLE IF NOT EXISTS output_files (
+	output TEXT NOT NULL,
+	path TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	mod_time INTEGER NOT NULL,
+	hash TEXT NOT NULL DEFAULT '',
+	scan_id TEXT NOT NULL,
+	PRIMARY KEY (output, path)
+);
+`
+
+// stateMigrations upgrade scan state written by earlier versions, in order.
+// The number applied so far is kept as the user_version of the database.
+var stateMigrations = []string{
+	// The files table from before outputs were kept apart is dropped, as
+	// which output it was for isn't known.
+	`DROP TABLE IF EXISTS files;`,
+}
+
+// fileState is what a scan saw of a file.
+type fileState struct {
+	path    string
+	size    int64
+	modTime time.Time
+	// hash is the SHA-1 of the file, if scans are hashing files.
+	hash string
+}
+
+// changed reports whether the file described by s differs from the one seen
+// by a previous scan.
+func (s *fileState) changed(prev *fileState) bool {
+	if prev == nil {
+		return true
+	}
+	if s.size == prev.size && s.modTime.Equal(prev.modTime) {
+		return false
+	}
+	// A file whose modification time changed but whose content didn't, as
+	// when it's copied or touched, is unchanged.
+	return s.hash == "" || s.hash != prev.hash
+}
+
+// scanState is the set of files sent to an output by previous scans, stored
+// in an SQLite database so that a scan only sends new, changed, and removed
+// files.
+type scanState struct {
+	filename string
+	// output identifies the output that the files were sent to
+	output string
+	db     *sql.DB
+}
+
+// defaultStatePath returns the suggested state file under the XDG state
+// folder, such as ~/.local/state/lm/scan-state.db.
+func defaultStatePath() string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "lm", "scan-state.db")
+}
+
+func openScanState(filename, output string) (*scanState, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return nil, fmt.Errorf("error creating folder for scan state %s: %v", filename, err)
+	}
+
+	db, err := sql.Open("sqlite", filename+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("error opening scan state %s: %v", filename, err)
+	}
+	if err := migrateState(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error upgrading scan state %s: %v", filename, err)
+	}
+	if _, err := db.Exec(stateSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating scan state tables in %s: %v", filename, err)
+	}
+	return &scanState{filename: filename, output: output, db: db}, nil
+}
+
+// migrateState applies the migrations that haven't been applied to db yet.
+func migrateState(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	for ; version < len(stateMigrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(stateMigrations[version]); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *scanState) Close() error {
+	return s.db.Close()
+}
+
+// load returns the files seen by previous scans within the given folders.
+// Each folder is read as a range of paths, which the primary key index
+// serves, rather than reading every file sent to the output.
+func (s *scanState) load(folders []string) (map[string]*fileState, error) {
+	files := map[string]*fileState{}
+	for _, folder := range folders {
+		if err := s.loadFolder(folder, files); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// loadFolder adds the files seen within folder to files.
+func (s *scanState) loadFolder(folder string, files map[string]*fileState) error {
+	// Paths within the folder sort from the folder itself up to, but not
+	// including, the folder followed by the character after the separator.
+	// Names such as folder-2 sort in between, so they're filtered out.
+	end := folder + string(filepath.Separator+1)
+	rows, err := s.db.Query("SELECT path, size, mod_time, hash FROM output_files WHERE output = ? AND path >= ? AND path < ?", s.output, folder, end)
+	if err != nil {
+		return fmt.Errorf("error reading scan state %s: %v", s.filename, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		f := &fileState{}
+		var modTime int64
+		if err := rows.Scan(&f.path, &f.size, &modTime, &f.hash); err != nil {
+			return fmt.Errorf("error reading scan state %s: %v", s.filename, err)
+		}
+		if !inFolders(f.path, []string{folder}) {
+			continue
+		}
+		f.modTime = time.Unix(0, modTime).UTC()
+		files[f.path] = f
+	}
+	return rows.Err()
+}
+
+// save records the files sent by a scan and forgets the removed ones.
+func (s *scanState) save(scanId string, sent []*fileState, removed []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error saving scan state %s: %v", s.filename, err)
+	}
+	defer tx.Rollback()
+
+	for _, f := range sent {
+		if _, err := tx.Exec("INSERT OR REPLACE INTO output_files (output, path, size, mod_time, hash, scan_id) VALUES (?, ?, ?, ?, ?, ?)",
+			s.output, f.path, f.size, f.modTime.UnixNano(), f.hash, scanId); err != nil {
+			return fmt.Errorf("error saving scan state for %s: %v", f.path, err)
+		}
+	}
+	for _, path := range removed {
+		if _, err := tx.Exec("DELETE FROM output_files WHERE output = ? AND path = ?", s.output, path); err != nil {
+			return fmt.Errorf("error removing scan state for %s: %v", path, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// inFolders reports whether path is within one of folders.
+func inFolders(path string, folders []string) bool {
+	for _, folder := range folders {
+		if path == folder || strings.HasPrefix(path, folder+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func hashFile(path string) (string, error) {
+	f, err := archive.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha1.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("error hashing %s: %v", path, err)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
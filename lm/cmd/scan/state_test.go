@@ -0,0 +1,97 @@
+package scan
+
+import (
+	"database/sql"
+	"maps"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestScanStateLoad(t *testing.T) {
+	state, err := openScanState(filepath.Join(t.TempDir(), "state.db"), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	paths := []string{
+		"/music/gd1977-05-08/d1t01.flac",
+		"/music/gd1977-05-08/show.zip!/d1t02.flac",
+		"/music/gd1977-05-08-2/d1t01.flac",
+		"/music/gd1977-05-080/d1t01.flac",
+		"/music/gd1978-01-22/d1t01.flac",
+	}
+	sent := []*fileState{}
+	for _, p := range paths {
+		sent = append(sent, &fileState{path: p, size: 1, modTime: time.Unix(1, 0)})
+	}
+	if err := state.save("scan", sent, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := openScanState(state.filename, "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if files, err := other.load([]string{"/music"}); err != nil || len(files) != 0 {
+		t.Errorf("load() for another output = %d files, %v, want none", len(files), err)
+	}
+
+	files, err := state.load([]string{"/music/gd1977-05-08"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/music/gd1977-05-08/d1t01.flac", "/music/gd1977-05-08/show.zip!/d1t02.flac"}
+	if got := slices.Sorted(maps.Keys(files)); !slices.Equal(got, want) {
+		t.Errorf("load() = %q, want %q", got, want)
+	}
+}
+
+func TestScanStateMigrate(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "state.db")
+	db, err := sql.Open("sqlite", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE TABLE files (path TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	tables := func() []string {
+		t.Helper()
+		state, err := openScanState(filename, "stdout")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer state.Close()
+		rows, err := state.db.Query("SELECT name FROM sqlite_master WHERE type = 'table' ORDER BY name")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		names := []string{}
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, name)
+		}
+		// A files table made once the migrations have run is left alone
+		if _, err := state.db.Exec("CREATE TABLE IF NOT EXISTS files (path TEXT)"); err != nil {
+			t.Fatal(err)
+		}
+		return names
+	}
+
+	if got, want := tables(), []string{"output_files"}; !slices.Equal(got, want) {
+		t.Errorf("tables = %q, want %q", got, want)
+	}
+	if got, want := tables(), []string{"files", "output_files"}; !slices.Equal(got, want) {
+		t.Errorf("tables after reopening = %q, want %q", got, want)
+	}
+}
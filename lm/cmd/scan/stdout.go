@@ -1,6 +1,10 @@
 package scan
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/organicveggie/livemusic/lm/message"
+)
 
 type FileAddStdOut struct{}
 
@@ -8,8 +12,16 @@ func newFileAddStdOut() *FileAddStdOut {
 	return &FileAddStdOut{}
 }
 
-func (fas *FileAddStdOut) AddFile(filename string) error {
-	fmt.Printf("%q\n", filename)
+func (fas *FileAddStdOut) AddFile(f *message.File) error {
+	if f.Event == message.EventRemoved {
+		fmt.Printf("removed %q\n", f.Path)
+		return nil
+	}
+	fmt.Printf("%q\n", f.Path)
+	return nil
+}
+
+func (f *FileAddStdOut) Flush() error {
 	return nil
 }
 
@@ -0,0 +1,201 @@
+package scan
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// walker finds the files below a scan root, limited to a depth of folders,
+// optionally following symbolic links and staying on the root's file system.
+type walker struct {
+	// maxDepth is how many levels of folders below the root are walked, or
+	// -1 for no limit.
+	maxDepth       int
+	followSymlinks bool
+	oneFileSystem  bool
+
+	// unscanned holds the folders whose contents weren't looked at, because
+	// they're too deep, couldn't be read, or are on another file system. The
+	// files a previous scan found in them aren't known to be removed. Each
+	// scan starts it over.
+	unscanned []string
+	// seen maps the real path of each folder walked to its path, when
+	// following links, so that a folder is only walked once.
+	seen map[string]string
+}
+
+// walkFunc is called for each file and folder below the root. depth is 1 for
+// the entries of the root. Returning filepath.SkipDir for a folder skips it.
+type walkFunc func(path string, info fs.FileInfo, depth int) error
+
+func newWalker(maxDepth int, followSymlinks, oneFileSystem bool) *walker {
+	return &walker{maxDepth: maxDepth, followSymlinks: followSymlinks, oneFileSystem: oneFileSystem}
+}
+
+// walk calls fn for the files and folders below root, which is depth levels
+// below its scan root, counting the ones it skips in skipped, which may be
+// nil.
+func (w *walker) walk(root string, depth int, skipped *skipSummary, fn walkFunc) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	real := root
+	if w.followSymlinks {
+		if real, err = filepath.EvalSymlinks(root); err != nil {
+			return err
+		}
+	}
+	w.seen = map[string]string{real: root}
+	if w.maxDepth >= 0 && depth > w.maxDepth {
+		return nil
+	}
+	dev, _ := device(info)
+	return w.walkDir(root, real, depth, dev, skipped, fn)
+}
+
+func (w *walker) walkDir(dir, real string, depth int, dev uint64, skipped *skipSummary, fn walkFunc) error {
+	// ReadDir returns the entries it read before an error
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		fmt.Printf("WARNING: unable to read folder %s: %v\n", dir, err)
+		skipped.add("that couldn't be read", true)
+		w.unscanned = append(w.unscanned, dir)
+	}
+
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		entryReal := filepath.Join(real, e.Name())
+		info, err := e.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			// Removed since the folder was read
+			continue
+		} else if err != nil {
+			fmt.Printf("WARNING: unable to read file info for %s: %v\n", path, err)
+			continue
+		}
+
+		if info.Mode()&fs.ModeSymlink != 0 {
+			target, targetReal, reason := w.followLink(path, real)
+			if reason != "" {
+				if isDir := target != nil && target.IsDir(); isDir || isMedia(path) {
+					skipped.add(reason, isDir)
+				}
+				continue
+			}
+			info, entryReal = target, targetReal
+		}
+
+		if !info.IsDir() {
+			if err := fn(path, info, depth+1); err != nil && err != filepath.SkipDir {
+				return err
+			}
+			continue
+		}
+
+		if w.followSymlinks {
+			if other, ok := w.seen[entryReal]; ok {
+				fmt.Printf("Not scanning %s again, as it's the same folder as %s\n", path, other)
+				skipped.add("that are the same as a folder already scanned", true)
+				continue
+			}
+			w.seen[entryReal] = path
+		}
+		if d, ok := device(info); ok && w.oneFileSystem && d != dev {
+			skipped.add("on another file system", true)
+			w.unscanned = append(w.unscanned, path)
+			continue
+		}
+		if w.maxDepth >= 0 && depth+1 > w.maxDepth {
+			skipped.add("deeper than the maximum depth", true)
+			w.unscanned = append(w.unscanned, path)
+			continue
+		}
+
+		if err := fn(path, info, depth+1); err == filepath.SkipDir {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := w.walkDir(path, entryReal, depth+1, dev, skipped, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// followLink returns the file or folder that the link at path points to and
+// its real path, or why it isn't followed. real is the real path of the
+// folder holding the link. The returned info is nil if the link is broken.
+func (w *walker) followLink(path, real string) (fs.FileInfo, string, string) {
+	target, err := os.Stat(path)
+	if err == nil && w.followSymlinks {
+		var targetReal string
+		if targetReal, err = filepath.EvalSymlinks(path); err == nil {
+			if target.IsDir() && inFolders(real, []string{targetReal}) {
+				fmt.Printf("WARNING: not following symbolic link %s to %s, which is a loop\n", path, targetReal)
+				return target, "", "that are symbolic link loops"
+			}
+			return target, targetReal, ""
+		}
+	}
+	if err != nil {
+		fmt.Printf("WARNING: unable to follow symbolic link %s: %v\n", path, err)
+		return nil, "", "with broken symbolic links"
+	}
+	return target, "", "that are symbolic links, without --follow_symlinks"
+}
+
+// stat returns the info for path, following it if it's a symbolic link and
+// links are followed.
+func (w *walker) stat(path string) (fs.FileInfo, error) {
+	if w.followSymlinks {
+		return os.Stat(path)
+	}
+	return os.Lstat(path)
+}
+
+// tooDeep reports whether the folder at path is deeper below its root in
+// roots than the walker goes.
+func (w *walker) tooDeep(roots []string, path string) bool {
+	return w.maxDepth >= 0 && depthIn(roots, path) > w.maxDepth
+}
+
+// throughLink reports whether path is reached through a symbolic link below
+// its root in roots that the walker doesn't follow.
+func (w *walker) throughLink(roots []string, path string) bool {
+	if w.followSymlinks {
+		return false
+	}
+	for _, root := range roots {
+		if !inFolders(path, []string{root}) {
+			continue
+		}
+		for p := path; p != root; p = filepath.Dir(p) {
+			if info, err := os.Lstat(p); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// depthIn returns how many levels of folders path is below the root in roots
+// that holds it.
+func depthIn(roots []string, path string) int {
+	for _, root := range roots {
+		if inFolders(path, []string{root}) {
+			rel, _ := filepath.Rel(root, path)
+			if rel == "." {
+				return 0
+			}
+			return strings.Count(rel, string(filepath.Separator)) + 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package scan
+
+import "io/fs"
+
+// device isn't supported on this platform, so --one_file_system has no
+// effect.
+func device(info fs.FileInfo) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package scan
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// device returns the ID of the device holding the file described by info.
+func device(info fs.FileInfo) (uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
@@ -0,0 +1,252 @@
+package scan
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/organicveggie/livemusic/lm/archive"
+)
+
+// watcher follows changes to the scan folders. Folders that change are marked
+// dirty and only scanned once they've gone a while without changes, so that a
+// show being copied into the library is sent once it has been copied.
+type watcher struct {
+	run     *scanRun
+	folders []string
+	notify  *fsnotify.Watcher
+
+	// watched is the set of folders being watched
+	watched map[string]bool
+	// dirty holds the time of the last change to each folder that changed
+	// since it was last scanned
+	dirty map[string]time.Time
+}
+
+// watch sends new, changed, and removed files in folders as they change,
+// until it's interrupted.
+func (r *scanRun) watch(ctx context.Context, folders []string) error {
+	ctx, stop := signal.NotifyContext(cmp.Or(ctx, context.Background()), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	notify, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("error starting file watcher: %v", err)
+	}
+	defer notify.Close()
+
+	w := &watcher{
+		run:     r,
+		folders: folders,
+		notify:  notify,
+		watched: map[string]bool{},
+		dirty:   map[string]time.Time{},
+	}
+	for _, folder := range folders {
+		w.addTree(folder, false)
+	}
+	fmt.Printf("Watching %d folders for changes, waiting %v for copies to finish\n", len(w.watched), cfg.settle)
+
+	ticker := time.NewTicker(min(cfg.settle, time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("Stopped watching")
+			return nil
+		case ev, ok := <-notify.Events:
+			if !ok {
+				return nil
+			}
+			w.handle(ev)
+		case err, ok := <-notify.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Printf("WARNING: %v\n", err)
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				// Changes were missed, so check every folder
+				for dir := range w.watched {
+					w.dirty[dir] = time.Now()
+				}
+			}
+		case now := <-ticker.C:
+			if err := w.scanSettled(now); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// handle marks the folders affected by a change as dirty, and starts watching
+// new folders.
+func (w *watcher) handle(ev fsnotify.Event) {
+	dir := filepath.Dir(ev.Name)
+	if ev.Has(fsnotify.Create) {
+		info, err := w.run.walk.stat(ev.Name)
+		if err == nil && info.IsDir() && !w.run.walk.tooDeep(w.folders, ev.Name) && w.run.ignore.skipTree(ev.Name) == "" {
+			// Files may have been added before the folder was watched
+			w.addTree(ev.Name, true)
+		}
+	}
+	if ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename) {
+		if w.watched[ev.Name] {
+			w.removeTree(ev.Name)
+		}
+	}
+	if filepath.Base(ev.Name) == ignoreFilename && w.watched[dir] {
+		// The files and folders that are skipped may have changed
+		w.run.ignore.reset()
+		w.addTree(dir, false)
+		for d := range w.watched {
+			if inFolders(d, []string{dir}) {
+				w.dirty[d] = time.Now()
+			}
+		}
+	}
+
+	if w.watched[dir] {
+		w.dirty[dir] = time.Now()
+	}
+}
+
+// addTree watches root and every folder below it. dirty marks them as dirty.
+func (w *watcher) addTree(root string, dirty bool) {
+	add := func(path string) {
+		if w.watched[path] {
+			return
+		}
+		if err := w.notify.Add(path); err != nil {
+			fmt.Printf("WARNING: unable to watch folder %s: %v\n", path, err)
+			return
+		}
+		w.watched[path] = true
+		if dirty {
+			w.dirty[path] = time.Now()
+		}
+	}
+
+	add(root)
+	err := w.run.walk.walk(root, depthIn(w.folders, root), nil, func(path string, info fs.FileInfo, depth int) error {
+		if !info.IsDir() {
+			return nil
+		}
+		if w.run.ignore.skip(path, true, 0) != "" {
+			return filepath.SkipDir
+		}
+		add(path)
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("WARNING: unable to watch folder %s: %v\n", root, err)
+	}
+}
+
+// removeTree stops watching root and the folders below it, which have been
+// removed or moved, marking them as dirty so that their files are removed.
+func (w *watcher) removeTree(root string) {
+	for dir := range w.watched {
+		if inFolders(dir, []string{root}) {
+			// The watch is already gone if the folder was removed
+			w.notify.Remove(dir)
+			delete(w.watched, dir)
+			w.dirty[dir] = time.Now()
+		}
+	}
+}
+
+// scanSettled scans the dirty folders that haven't changed for the settle
+// time.
+func (w *watcher) scanSettled(now time.Time) error {
+	for _, dir := range slices.Sorted(maps.Keys(w.dirty)) {
+		if now.Sub(w.dirty[dir]) < cfg.settle {
+			continue
+		}
+		delete(w.dirty, dir)
+		if err := w.scanFolder(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanFolder sends the changes to the files directly within dir. The files of
+// a folder that no longer exists, and of the folders below it, are sent as
+// removed. Folders that are now skipped are left alone, as their files
+// haven't been removed.
+func (w *watcher) scanFolder(dir string) error {
+	if w.run.ignore.skipTree(dir) != "" {
+		return nil
+	}
+	// Only the archives in dir that can't be read matter here, rather than
+	// what earlier scans and the walks that add watches couldn't look into.
+	w.run.walk.unscanned = nil
+
+	files := map[string]fs.FileInfo{}
+	entries, err := os.ReadDir(dir)
+	gone := errors.Is(err, fs.ErrNotExist)
+	if err != nil && !gone {
+		fmt.Printf("WARNING: unable to read folder %s: %v\n", dir, err)
+		return nil
+	}
+
+	skipped := newSkipSummary()
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if gone || !(isMedia(path) || w.run.isArchive(path)) {
+			continue
+		}
+		info, err := w.run.walk.stat(path)
+		if err != nil {
+			fmt.Printf("WARNING: unable to read file info for %s: %v\n", path, err)
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		if reason := w.run.ignore.skip(path, false, info.Size()); reason != "" {
+			skipped.add(reason, false)
+			continue
+		}
+		if w.run.isArchive(path) {
+			w.run.addArchive(path, files, skipped)
+			continue
+		}
+		files[path] = info
+	}
+	skipped.print()
+
+	prev := map[string]*fileState{}
+	if w.run.state != nil {
+		if prev, err = w.run.state.load([]string{dir}); err != nil {
+			return err
+		}
+		if !gone {
+			// Folders below dir are scanned on their own, while the
+			// archives in it are scanned with it
+			maps.DeleteFunc(prev, func(path string, _ *fileState) bool {
+				if archivePath, _, ok := archive.Split(path); ok {
+					path = archivePath
+				}
+				return filepath.Dir(path) != dir
+			})
+		}
+		maps.DeleteFunc(prev, w.run.excluded)
+	}
+	if len(files) == 0 && len(prev) == 0 {
+		return nil
+	}
+
+	fmt.Printf("Processing folder %s\n", dir)
+	return w.run.emit(prev, files)
+}
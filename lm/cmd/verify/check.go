@@ -0,0 +1,186 @@
+package verify
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/organicveggie/livemusic/lm/audio/flac"
+	"github.com/organicveggie/livemusic/lm/audio/formats"
+	"github.com/organicveggie/livemusic/lm/audio/shn"
+)
+
+type fileStatus string
+
+const (
+	statusOK          fileStatus = "ok"
+	statusMismatch    fileStatus = "mismatch"
+	statusMissing     fileStatus = "missing"
+	statusUnsupported fileStatus = "unsupported"
+	statusError       fileStatus = "error"
+)
+
+type FileResult struct {
+	Filename string       `json:"filename"`
+	Manifest string       `json:"manifest"`
+	Kind     manifestKind `json:"kind"`
+	Status   fileStatus   `json:"status"`
+	Expected string       `json:"expected"`
+	Actual   string       `json:"actual,omitempty"`
+	Error    string       `json:"error,omitempty"`
+}
+
+type FolderResult struct {
+	Folder    string       `json:"folder"`
+	Manifests []string     `json:"manifests"`
+	Files     []FileResult `json:"files"`
+	Extra     []string     `json:"extra,omitempty"`
+}
+
+// Count returns the number of files with the given status.
+func (fr *FolderResult) Count(status fileStatus) int {
+	count := 0
+	for _, f := range fr.Files {
+		if f.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// Failed reports whether any file in the folder is missing, mismatched, or
+// couldn't be checked due to an error.
+func (fr *FolderResult) Failed() bool {
+	return fr.Count(statusMismatch)+fr.Count(statusMissing)+fr.Count(statusError) > 0
+}
+
+// verifyFolder checks every file listed in the manifests of a folder. Files
+// of the formats in audio that none of the manifests list are reported as
+// extra.
+func verifyFolder(folder string, manifestPaths []string, audio *formats.Registry) *FolderResult {
+	result := &FolderResult{Folder: folder}
+
+	listed := map[string]bool{}
+	for _, path := range manifestPaths {
+		result.Manifests = append(result.Manifests, filepath.Base(path))
+
+		mf, err := readManifest(path)
+		if err != nil {
+			result.Files = append(result.Files, FileResult{
+				Manifest: filepath.Base(path),
+				Status:   statusError,
+				Error:    err.Error(),
+			})
+			continue
+		}
+
+		for _, entry := range mf.Entries {
+			listed[strings.ToLower(entry.Filename)] = true
+			result.Files = append(result.Files, verifyEntry(folder, mf, entry))
+		}
+	}
+
+	entries, err := os.ReadDir(folder)
+	if err == nil {
+		for _, e := range entries {
+			if !e.IsDir() && audio.ForFile(e.Name()) != nil && !listed[strings.ToLower(e.Name())] {
+				result.Extra = append(result.Extra, e.Name())
+			}
+		}
+	}
+	slices.Sort(result.Extra)
+
+	return result
+}
+
+func verifyEntry(folder string, mf *manifest, entry manifestEntry) FileResult {
+	fr := FileResult{
+		Filename: entry.Filename,
+		Manifest: filepath.Base(mf.Path),
+		Kind:     mf.Kind,
+		Expected: entry.Hash,
+	}
+
+	path, err := findFile(folder, entry.Filename)
+	if err != nil {
+		fr.Status = statusMissing
+		return fr
+	}
+
+	fr.Actual, err = checksum(mf.Kind, path)
+	switch {
+	case err == errUnsupported:
+		fr.Status = statusUnsupported
+	case err != nil:
+		fr.Status = statusError
+		fr.Error = err.Error()
+	case fr.Actual == fr.Expected:
+		fr.Status = statusOK
+	default:
+		fr.Status = statusMismatch
+	}
+	return fr
+}
+
+// findFile locates a file listed in a manifest. Manifests created on
+// case-insensitive file systems don't always match the case of the file.
+func findFile(folder, name string) (string, error) {
+	path := filepath.Join(folder, name)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	dir := filepath.Dir(path)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, e := range entries {
+		if strings.EqualFold(e.Name(), filepath.Base(path)) {
+			return filepath.Join(dir, e.Name()), nil
+		}
+	}
+	return "", os.ErrNotExist
+}
+
+var errUnsupported = fmt.Errorf("unsupported checksum type")
+
+func checksum(kind manifestKind, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	switch kind {
+	case kindMD5:
+		h := md5.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return "", fmt.Errorf("error reading %s: %v", path, err)
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	case kindFFP:
+		// Fingerprint tools list the STREAMINFO signature as is, even when the
+		// encoder left it empty.
+		si, err := flac.ReadStreamInfo(f)
+		if err != nil {
+			return "", err
+		}
+		return si.MD5String(), nil
+	case kindST5:
+		// shntool checksums the decoded audio, which for FLAC files is the
+		// same data the STREAMINFO signature covers.
+		if strings.EqualFold(filepath.Ext(path), ".flac") {
+			return flac.AudioMD5(f)
+		}
+		sum, _, err := shn.AudioMD5(f)
+		return sum, err
+	default:
+		return "", errUnsupported
+	}
+}
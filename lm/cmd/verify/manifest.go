@@ -0,0 +1,123 @@
+package verify
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/organicveggie/livemusic/lm/etree"
+)
+
+type manifestKind string
+
+const (
+	// kindMD5 manifests list the MD5 checksum of each whole file.
+	kindMD5 manifestKind = "md5"
+	// kindFFP manifests list the FLAC fingerprint: the MD5 signature of the
+	// decoded audio stored in the FLAC STREAMINFO block.
+	kindFFP manifestKind = "ffp"
+	// kindST5 manifests list the MD5 checksum of the decoded audio of
+	// Shorten files, as computed by shntool.
+	kindST5 manifestKind = "st5"
+)
+
+var (
+	manifestRegEx = regexp.MustCompile(`(?i)[.](md5|ffp|st5)([.]txt)?$`)
+
+	md5LineRegEx    = regexp.MustCompile(`^([0-9a-fA-F]{32})\s+(?:\[shntool\]\s+)?\*?(.+)$`)
+	md5BSDLineRegEx = regexp.MustCompile(`^MD5\s*\((.+)\)\s*=\s*([0-9a-fA-F]{32})$`)
+	ffpLineRegEx    = regexp.MustCompile(`^(.+):([0-9a-fA-F]{32})$`)
+
+	// driveRegEx matches Windows paths that start with a drive letter.
+	driveRegEx = regexp.MustCompile(`^[A-Za-z]:/`)
+)
+
+type manifestEntry struct {
+	Filename string
+	Hash     string
+}
+
+type manifest struct {
+	Path    string
+	Kind    manifestKind
+	Entries []manifestEntry
+}
+
+// manifestKindFor returns the kind of checksum manifest filename is, if any.
+func manifestKindFor(filename string) (manifestKind, bool) {
+	m := manifestRegEx.FindStringSubmatch(filename)
+	if m == nil {
+		return "", false
+	}
+	return manifestKind(strings.ToLower(m[1])), true
+}
+
+func readManifest(path string) (*manifest, error) {
+	kind, ok := manifestKindFor(path)
+	if !ok {
+		return nil, fmt.Errorf("unknown manifest type: %s", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening manifest %s: %v", path, err)
+	}
+	defer f.Close()
+
+	mf := &manifest{Path: path, Kind: kind}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(etree.ToUTF8(scanner.Bytes()))
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var entry manifestEntry
+		if kind == kindFFP {
+			m := ffpLineRegEx.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			entry = manifestEntry{Filename: m[1], Hash: m[2]}
+		} else if m := md5LineRegEx.FindStringSubmatch(line); m != nil {
+			entry = manifestEntry{Filename: m[2], Hash: m[1]}
+		} else if m := md5BSDLineRegEx.FindStringSubmatch(line); m != nil {
+			entry = manifestEntry{Filename: m[1], Hash: m[2]}
+		} else {
+			continue
+		}
+
+		// Names outside the folder are skipped, so that a manifest can't
+		// have other files read.
+		if entry.Filename, ok = cleanManifestFilename(entry.Filename); !ok {
+			continue
+		}
+		entry.Hash = strings.ToLower(entry.Hash)
+		mf.Entries = append(mf.Entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading manifest %s: %v", path, err)
+	}
+
+	return mf, nil
+}
+
+// cleanManifestFilename converts a filename from a manifest, which may have
+// been written on Windows, into a relative path for this system. It returns
+// false for absolute names and names that point outside the folder.
+func cleanManifestFilename(name string) (string, bool) {
+	name = strings.TrimSpace(strings.ReplaceAll(name, `\`, "/"))
+	if strings.HasPrefix(name, "/") || driveRegEx.MatchString(name) {
+		return "", false
+	}
+	name = path.Clean(name)
+	if name == "." || name == ".." || strings.HasPrefix(name, "../") {
+		return "", false
+	}
+	return filepath.FromSlash(name), true
+}
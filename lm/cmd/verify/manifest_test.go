@@ -0,0 +1,82 @@
+package verify
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		text     string
+		want     []manifestEntry
+	}{
+		{
+			"gnu md5",
+			"gd77-05-08.md5",
+			"6d9a1a4a0e1d7d0fc2c1f4b2a4b1c9e3 *gd77-05-08d1t01.flac\n" +
+				"0a8e6c1d2b1f3e4d5c6b7a8f9e0d1c2b  gd77-05-08d1t02.flac\n",
+			[]manifestEntry{
+				{"gd77-05-08d1t01.flac", "6d9a1a4a0e1d7d0fc2c1f4b2a4b1c9e3"},
+				{"gd77-05-08d1t02.flac", "0a8e6c1d2b1f3e4d5c6b7a8f9e0d1c2b"},
+			},
+		},
+		{
+			"bsd md5",
+			"gd77-05-08.md5",
+			"MD5 (gd77-05-08d1t01.flac) = 6D9A1A4A0E1D7D0FC2C1F4B2A4B1C9E3\n",
+			[]manifestEntry{{"gd77-05-08d1t01.flac", "6d9a1a4a0e1d7d0fc2c1f4b2a4b1c9e3"}},
+		},
+		{
+			"ffp",
+			"gd77-05-08.ffp.txt",
+			"; Generated by foobar2000\r\n" +
+				"gd77-05-08d1t01.flac:4b2b0bd1c1d8e6e7f0a9b8c7d6e5f4a3\r\n" +
+				"disc 2\\gd77-05-08d2t01.flac:a1b2c3d4e5f60718293a4b5c6d7e8f90\r\n",
+			[]manifestEntry{
+				{"gd77-05-08d1t01.flac", "4b2b0bd1c1d8e6e7f0a9b8c7d6e5f4a3"},
+				{filepath.FromSlash("disc 2/gd77-05-08d2t01.flac"), "a1b2c3d4e5f60718293a4b5c6d7e8f90"},
+			},
+		},
+		{
+			"st5",
+			"gd77-05-08.st5",
+			"2c8f1e0a9b7d6c5e4f3a2b1c0d9e8f7a  gd77-05-08d1t01.shn\n",
+			[]manifestEntry{{"gd77-05-08d1t01.shn", "2c8f1e0a9b7d6c5e4f3a2b1c0d9e8f7a"}},
+		},
+		{
+			"shntool",
+			"gd77-05-08.md5",
+			"2c8f1e0a9b7d6c5e4f3a2b1c0d9e8f7a  [shntool]  gd77-05-08d1t01.shn\n",
+			[]manifestEntry{{"gd77-05-08d1t01.shn", "2c8f1e0a9b7d6c5e4f3a2b1c0d9e8f7a"}},
+		},
+		{
+			"outside the folder",
+			"gd77-05-08.md5",
+			"6d9a1a4a0e1d7d0fc2c1f4b2a4b1c9e3 *../gd77-05-09/gd77-05-09d1t01.flac\n" +
+				"6d9a1a4a0e1d7d0fc2c1f4b2a4b1c9e3 *disc1/../../secret.flac\n" +
+				"6d9a1a4a0e1d7d0fc2c1f4b2a4b1c9e3 */etc/passwd\n" +
+				"6d9a1a4a0e1d7d0fc2c1f4b2a4b1c9e3 *C:\\Music\\gd77-05-08d1t01.flac\n" +
+				"6d9a1a4a0e1d7d0fc2c1f4b2a4b1c9e3 *./disc1/../gd77-05-08d1t01.flac\n",
+			[]manifestEntry{{"gd77-05-08d1t01.flac", "6d9a1a4a0e1d7d0fc2c1f4b2a4b1c9e3"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.filename)
+			if err := os.WriteFile(path, []byte(tt.text), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			mf, err := readManifest(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(mf.Entries, tt.want) {
+				t.Errorf("readManifest() entries = %q, want %q", mf.Entries, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package verify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/organicveggie/livemusic/lm/storage"
+)
+
+// recorder stores verification results on the tracks saved by analyze.
+type recorder struct {
+	store storage.Handler
+}
+
+func newRecorder(uri string) (*recorder, error) {
+	store, err := storage.Open(uri)
+	if err != nil {
+		return nil, fmt.Errorf("error loading storage handler for %q: %v", uri, err)
+	}
+	return &recorder{store: store}, nil
+}
+
+func (r *recorder) Close(ctx context.Context) error {
+	return r.store.Close(ctx)
+}
+
+func (r *recorder) record(ctx context.Context, result *FolderResult) error {
+	now := time.Now().UTC()
+
+	updated := int64(0)
+	for _, f := range result.Files {
+		if f.Filename == "" || f.Status == statusUnsupported {
+			continue
+		}
+
+		path := filepath.Join(result.Folder, f.Filename)
+		folder := filepath.Dir(path)
+		if abs, err := filepath.Abs(folder); err == nil {
+			folder = abs
+		}
+
+		n, err := r.store.SaveVerification(ctx, folder, filepath.Base(path), &storage.Verification{
+			Status:     string(f.Status),
+			Kind:       string(f.Kind),
+			Manifest:   f.Manifest,
+			VerifiedAt: now,
+		})
+		if err != nil {
+			return err
+		}
+		updated += n
+	}
+
+	fmt.Fprintf(os.Stderr, "Recorded verification on %d tracks in %s\n", updated, result.Folder)
+	return nil
+}
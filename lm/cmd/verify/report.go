@@ -0,0 +1,67 @@
+package verify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type reportFormat string
+
+const (
+	reportHuman reportFormat = "human"
+	reportJSON  reportFormat = "json"
+)
+
+// String is used both by fmt.Print and by Cobra in help text
+func (e *reportFormat) String() string {
+	return string(*e)
+}
+
+// Set must have pointer receiver so it doesn't change the value of a copy
+func (e *reportFormat) Set(v string) error {
+	switch v {
+	case "human", "json":
+		*e = reportFormat(v)
+		return nil
+	default:
+		return errors.New(`must be one of "human" or "json"`)
+	}
+}
+
+// Type is only used in help text
+func (e *reportFormat) Type() string {
+	return "reportFormat"
+}
+
+func writeReport(w io.Writer, format reportFormat, results []*FolderResult) error {
+	if format == reportJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+
+	for _, r := range results {
+		fmt.Fprintf(w, "%s [%s]\n", r.Folder, strings.Join(r.Manifests, ", "))
+		fmt.Fprintf(w, "  %d ok, %d mismatched, %d missing, %d extra, %d unsupported, %d errors\n",
+			r.Count(statusOK), r.Count(statusMismatch), r.Count(statusMissing), len(r.Extra),
+			r.Count(statusUnsupported), r.Count(statusError))
+
+		for _, f := range r.Files {
+			switch f.Status {
+			case statusMismatch:
+				fmt.Fprintf(w, "  MISMATCH %s (%s): expected %s, got %s\n", f.Filename, f.Manifest, f.Expected, f.Actual)
+			case statusMissing:
+				fmt.Fprintf(w, "  MISSING  %s (%s)\n", f.Filename, f.Manifest)
+			case statusError:
+				fmt.Fprintf(w, "  ERROR    %s (%s): %s\n", f.Filename, f.Manifest, f.Error)
+			}
+		}
+		for _, name := range r.Extra {
+			fmt.Fprintf(w, "  EXTRA    %s\n", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package verify
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/organicveggie/livemusic/lm/audio/formats"
+	"github.com/spf13/cobra"
+)
+
+type commandConfig struct {
+	format      reportFormat
+	mongoURI    string
+	record      bool
+	formats     []string
+	skipFormats []string
+
+	// audio is the registry of the enabled formats, set by checkFlags
+	audio *formats.Registry
+}
+
+func (c *commandConfig) checkFlags() error {
+	if c.record {
+		c.mongoURI = cmp.Or(c.mongoURI, os.Getenv("MONGODB_URI"))
+		if c.mongoURI == "" {
+			return fmt.Errorf("missing required storage connection string for --record")
+		}
+	}
+
+	var err error
+	c.audio, err = formats.New(c.formats, c.skipFormats)
+	return err
+}
+
+var (
+	cfg commandConfig
+
+	Cmd = &cobra.Command{
+		Use:          "verify [folder] {folder2 ... folderN}",
+		Short:        "Verify files against md5, ffp, and st5 checksum manifests",
+		Args:         cobra.MinimumNArgs(1),
+		RunE:         verify,
+		SilenceUsage: true,
+	}
+)
+
+func init() {
+	// Set defaults
+	cfg.format = reportHuman
+
+	Cmd.Flags().StringVarP(&cfg.mongoURI, "mongodb_uri", "m", "", "MongoDB connection string, or sqlite:///path/lm.db for a local SQLite database")
+	Cmd.Flags().VarP(&cfg.format, "output_format", "o", `Report format: "human", "json".`)
+	Cmd.Flags().BoolVar(&cfg.record, "record", false, "Record verification results on stored tracks")
+	Cmd.Flags().StringSliceVar(&cfg.formats, "formats", nil, fmt.Sprintf("Audio formats to report unlisted files of, or all of them if empty: %s", strings.Join(formats.Names(), ",")))
+	Cmd.Flags().StringSliceVar(&cfg.skipFormats, "skip_formats", nil, "Audio formats not to report unlisted files of")
+}
+
+func verify(cmd *cobra.Command, args []string) error {
+	if err := cfg.checkFlags(); err != nil {
+		return err
+	}
+
+	ctx := cmp.Or(cmd.Context(), context.Background())
+
+	folders, err := findManifests(args)
+	if err != nil {
+		return err
+	}
+
+	var rec *recorder
+	if cfg.record {
+		if rec, err = newRecorder(cfg.mongoURI); err != nil {
+			return err
+		}
+		defer rec.Close(ctx)
+	}
+
+	results := []*FolderResult{}
+	failed := 0
+	for _, folder := range slices.Sorted(maps.Keys(folders)) {
+		result := verifyFolder(folder, folders[folder], cfg.audio)
+		results = append(results, result)
+		if result.Failed() {
+			failed++
+		}
+
+		if rec != nil {
+			if err := rec.record(ctx, result); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := writeReport(os.Stdout, cfg.format, results); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("verification failed for %d of %d folders", failed, len(results))
+	}
+	return nil
+}
+
+// findManifests returns the checksum manifests found under each folder,
+// grouped by the folder containing them.
+func findManifests(args []string) (map[string][]string, error) {
+	folders := map[string][]string{}
+	for _, folder := range args {
+		fileInfo, err := os.Stat(folder)
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("folder not found: %s", folder)
+		}
+		if err == nil && !fileInfo.IsDir() {
+			return nil, fmt.Errorf("invalid folder: %s", folder)
+		}
+
+		err = filepath.WalkDir(folder, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if _, ok := manifestKindFor(path); ok && !d.IsDir() {
+				dir := filepath.Dir(path)
+				folders[dir] = append(folders[dir], path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error searching %s for manifests: %v", folder, err)
+		}
+	}
+	return folders, nil
+}
@@ -0,0 +1,206 @@
+// Package config loads settings shared by the lm commands from a YAML config
+// file with named profiles, and from LM_* environment variables.
+//
+// A setting given as a flag wins over the environment, which wins over the
+// config file, which wins over the flag's default:
+//
+//	default_profile: home
+//	profiles:
+//	  home:
+//	    mongodb_uri: mongodb://nas:27017
+//	    queue: mongo
+//	    library_roots: [/mnt/music/live]
+//	    skip_formats: [dsf]
+//	    excludes: ["._*", "@eaDir/", _incomplete/, sample/]
+//	    min_size: 256K
+//	  local:
+//	    queue: sqs
+//	    region: us-east-1
+//	    sqs_endpoint: http://localhost:9324
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// EnvPrefix is prepended to the upper case name of a flag to get the
+	// environment variable that sets it.
+	EnvPrefix = "LM_"
+
+	defaultProfile = "default"
+)
+
+// Profile is a named set of settings.
+type Profile struct {
+	MongoURI   string `yaml:"mongodb_uri"`
+	AWSProfile string `yaml:"aws_profile"`
+	// Queue is the transport between scan and analyze: "sqs" or "mongo".
+	Queue        string   `yaml:"queue"`
+	QueueName    string   `yaml:"queue_name"`
+	Region       string   `yaml:"region"`
+	SQSEndpoint  string   `yaml:"sqs_endpoint"`
+	LibraryRoots []string `yaml:"library_roots"`
+	// Formats and SkipFormats enable and disable audio formats by name for
+	// both scan and analyze.
+	Formats     []string `yaml:"formats"`
+	SkipFormats []string `yaml:"skip_formats"`
+	// Excludes are gitignore style patterns of files and folders for scan to
+	// skip, replacing the default ones, and MinSize is the size of the
+	// smallest audio file it sends, such as "512K".
+	Excludes []string `yaml:"excludes"`
+	MinSize  string   `yaml:"min_size"`
+}
+
+// Config is the contents of a config file.
+type Config struct {
+	DefaultProfile string              `yaml:"default_profile"`
+	Profiles       map[string]*Profile `yaml:"profiles"`
+}
+
+// DefaultPath returns the config file under the XDG config folder, such as
+// ~/.config/lm/config.yaml.
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "lm", "config.yaml")
+}
+
+// Load reads a config file. A missing file is an empty config unless
+// required is set.
+func Load(filename string, required bool) (*Config, error) {
+	c := &Config{}
+	b, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return c, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading config file %s: %v", filename, err)
+	}
+
+	if err := yaml.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %v", filename, err)
+	}
+	return c, nil
+}
+
+// Profile returns the named profile, or the default profile if name is
+// empty. The default profile may be missing, in which case it's empty.
+func (c *Config) Profile(name string) (*Profile, error) {
+	if name != "" {
+		p, ok := c.Profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("profile %q not found in config", name)
+		}
+		return p, nil
+	}
+
+	name = c.DefaultProfile
+	if name == "" {
+		name = defaultProfile
+	}
+	if p, ok := c.Profiles[name]; ok {
+		return p, nil
+	} else if c.DefaultProfile != "" {
+		return nil, fmt.Errorf("default profile %q not found in config", name)
+	}
+	return &Profile{}, nil
+}
+
+// profileFlags maps flag names to the profile settings that they're set from.
+var profileFlags = map[string]func(p *Profile) string{
+	"aws_profile":  func(p *Profile) string { return p.AWSProfile },
+	"min_size":     func(p *Profile) string { return p.MinSize },
+	"mongodb_uri":  func(p *Profile) string { return p.MongoURI },
+	"queue_name":   func(p *Profile) string { return p.QueueName },
+	"region":       func(p *Profile) string { return p.Region },
+	"sqs_endpoint": func(p *Profile) string { return p.SQSEndpoint },
+}
+
+// commandFlags maps the names of flags that only some commands take a
+// profile setting for to those settings, by command name. The queue
+// transport is where analyze reads files from and scan sends them to.
+var commandFlags = map[string]map[string]func(p *Profile) string{
+	"analyze": {
+		"source": func(p *Profile) string { return p.Queue },
+	},
+	"scan": {
+		"output_format": func(p *Profile) string {
+			if p.Queue == "sqs" {
+				return "queue"
+			}
+			return p.Queue
+		},
+	},
+}
+
+// profileSliceFlags maps list flag names to the profile settings that they're
+// set from. Each element is kept whole, even if it has a comma in it.
+var profileSliceFlags = map[string]func(p *Profile) []string{
+	"exclude":      func(p *Profile) []string { return p.Excludes },
+	"formats":      func(p *Profile) []string { return p.Formats },
+	"library_root": func(p *Profile) []string { return p.LibraryRoots },
+	"skip_formats": func(p *Profile) []string { return p.SkipFormats },
+}
+
+// Apply sets each flag that wasn't given on the command line from its LM_*
+// environment variable, or else from the profile. command is the name of the
+// command the flags belong to, and args are its positional arguments: analyze
+// only reads from the profile's queue when it isn't given files to analyze, as
+// arguments or with --file.
+func Apply(command string, flags *pflag.FlagSet, p *Profile, args []string) error {
+	givenFiles := len(args) > 0
+	if f := flags.Lookup("file"); f != nil && f.Changed {
+		givenFiles = true
+	}
+
+	var errs []error
+	flags.VisitAll(func(f *pflag.Flag) {
+		if f.Changed {
+			return
+		}
+
+		v := os.Getenv(EnvPrefix + strings.ToUpper(f.Name))
+		if v != "" {
+			if err := flags.Set(f.Name, v); err != nil {
+				errs = append(errs, fmt.Errorf("invalid value %q for --%s from %s%s: %v", v, f.Name, EnvPrefix, strings.ToUpper(f.Name), err))
+			}
+			return
+		}
+
+		if get, ok := profileSliceFlags[f.Name]; ok {
+			s, isSlice := f.Value.(pflag.SliceValue)
+			if vals := get(p); len(vals) > 0 && isSlice {
+				if err := s.Replace(vals); err != nil {
+					errs = append(errs, fmt.Errorf("invalid value %q for --%s from config: %v", vals, f.Name, err))
+				}
+				f.Changed = true
+			}
+			return
+		}
+
+		get, ok := profileFlags[f.Name]
+		if !ok {
+			get, ok = commandFlags[command][f.Name]
+		}
+		if !ok || (f.Name == "source" && givenFiles) {
+			return
+		}
+		if v = get(p); v == "" {
+			return
+		}
+		if err := flags.Set(f.Name, v); err != nil {
+			errs = append(errs, fmt.Errorf("invalid value %q for --%s from config: %v", v, f.Name, err))
+		}
+	})
+	return errors.Join(errs...)
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func newFlags() (*pflag.FlagSet, *string, *[]string) {
+	flags := pflag.NewFlagSet("analyze", pflag.ContinueOnError)
+	source := flags.String("source", "", "")
+	flags.String("file", "", "")
+	roots := flags.StringSlice("library_root", nil, "")
+	return flags, source, roots
+}
+
+func TestApplySlices(t *testing.T) {
+	flags, _, roots := newFlags()
+	p := &Profile{LibraryRoots: []string{"/music/live", "/music/a,b"}}
+	if err := Apply("analyze", flags, p, nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := p.LibraryRoots; !reflect.DeepEqual(*roots, want) {
+		t.Errorf("library_root = %q, want %q", *roots, want)
+	}
+}
+
+func TestApplySource(t *testing.T) {
+	p := &Profile{Queue: "sqs"}
+	tests := []struct {
+		name string
+		args []string
+		file string
+		want string
+	}{
+		{"no files", nil, "", "sqs"},
+		{"arguments", []string{"a.flac"}, "", ""},
+		{"file", nil, "files.txt", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags, source, _ := newFlags()
+			if tt.file != "" {
+				if err := flags.Set("file", tt.file); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := Apply("analyze", flags, p, tt.args); err != nil {
+				t.Fatal(err)
+			}
+			if *source != tt.want {
+				t.Errorf("source = %q, want %q", *source, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyOutputFormat(t *testing.T) {
+	p := &Profile{Queue: "sqs"}
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"scan", "queue"},
+		{"verify", "human"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			flags := pflag.NewFlagSet(tt.command, pflag.ContinueOnError)
+			format := flags.String("output_format", "human", "")
+			if err := Apply(tt.command, flags, p, nil); err != nil {
+				t.Fatal(err)
+			}
+			if *format != tt.want {
+				t.Errorf("output_format = %q, want %q", *format, tt.want)
+			}
+		})
+	}
+}
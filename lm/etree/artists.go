@@ -0,0 +1,74 @@
+package etree
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+)
+
+// ArtistTable maps etree artist abbreviations to full artist names.
+type ArtistTable map[string]string
+
+var defaultArtists = ArtistTable{
+	"abb":    "The Allman Brothers Band",
+	"bt":     "Blues Traveler",
+	"dmb":    "Dave Matthews Band",
+	"gd":     "Grateful Dead",
+	"gsbg":   "Greensky Bluegrass",
+	"jgb":    "Jerry Garcia Band",
+	"lf":     "Little Feat",
+	"moe":    "moe.",
+	"mmw":    "Medeski Martin & Wood",
+	"ph":     "Phish",
+	"phil":   "Phil Lesh & Friends",
+	"ratdog": "RatDog",
+	"sci":    "The String Cheese Incident",
+	"sts9":   "Sound Tribe Sector 9",
+	"tab":    "Trey Anastasio Band",
+	"um":     "Umphrey's McGee",
+	"wsp":    "Widespread Panic",
+	"ymsb":   "Yonder Mountain String Band",
+}
+
+// DefaultArtists returns a copy of the built in artist abbreviation table.
+func DefaultArtists() ArtistTable {
+	return maps.Clone(defaultArtists)
+}
+
+// LoadArtistTable reads artist abbreviations from filename and merges them
+// over the built in table. Each line has the form "abbr=Artist Name". Blank
+// lines and lines starting with "#" are ignored.
+func LoadArtistTable(filename string) (ArtistTable, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening artist table %s: %v", filename, err)
+	}
+	defer f.Close()
+
+	table := DefaultArtists()
+
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		abbr, name, found := strings.Cut(line, "=")
+		abbr = strings.ToLower(strings.TrimSpace(abbr))
+		name = strings.TrimSpace(name)
+		if !found || abbr == "" || name == "" {
+			return nil, fmt.Errorf("invalid artist table entry at %s:%d: %q", filename, lineNum, line)
+		}
+		table[abbr] = name
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading artist table %s: %v", filename, err)
+	}
+
+	return table, nil
+}
@@ -0,0 +1,250 @@
+package etree
+
+import (
+	"bufio"
+	"cmp"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// InfoText holds the fields parsed from the info text file that accompanies
+// most live recordings.
+type InfoText struct {
+	Artist   string
+	Date     time.Time
+	Venue    string
+	City     string
+	Source   string
+	Lineage  string
+	Taper    string
+	Transfer string
+	Setlist  []SetlistEntry
+}
+
+// SetlistEntry is a single song from the setlist of an info file.
+type SetlistEntry struct {
+	Disc     int
+	Set      int
+	Track    int
+	Title    string
+	Duration time.Duration
+}
+
+var (
+	fieldRegEx = regexp.MustCompile(`(?i)^(source|src|lineage|taper|taped by|recorded by|recording|transfer|transferred by|venue|location|city)\s*[:=]\s*(.*)$`)
+	discRegEx  = regexp.MustCompile(`(?i)^(?:disc|disk|cd|d)\s*(\d+)\s*[:.)-]?\s*$`)
+	setRegEx   = regexp.MustCompile(`(?i)^(set\s*(\d+|i{1,3}|one|two|three)|encore|e)\s*[:.)-]?\s*$`)
+	songRegEx  = regexp.MustCompile(`(?i)^(?:(?:d|cd)(\d+))?\s*(?:t|track\s*)?(\d{1,3})\s*[.):-]?\s+(.+?)$`)
+	timeRegEx  = regexp.MustCompile(`\s*[\[(]?((?:\d+:)?\d{1,2}:\d{2})(?:\.\d+)?[\])]?$`)
+	cityRegEx  = regexp.MustCompile(`,\s*[A-Za-z .]+$`)
+	dayRegEx   = regexp.MustCompile(`(?i)^(mon|tue|wed|thu|fri|sat|sun)[a-z]*,?\s+`)
+
+	// infoNameRegEx matches the names info files are given: the show's name,
+	// such as gd77-05-08 or gd1977-05-08.sbd.miller.12345, its shnid, or a
+	// generic name such as info or notes.
+	infoNameRegEx = regexp.MustCompile(`(?i)^(?:[a-z]+\d{2,4}[-.]\d{1,2}[-.]\d{1,2}.*|\d{3,}|.*(?:info|notes?|readme|setlist|details).*)$`)
+	// notInfoRegEx matches the names of text files holding checksums or
+	// ripping logs rather than show info.
+	notInfoRegEx = regexp.MustCompile(`(?i)(?:^|[^a-z])(?:ffp|md5s?|st5|sha1?|checksums?|fingerprints?|eac|logs?)(?:[^a-z]|$)`)
+)
+
+var dateLayouts = []string{
+	"2006-01-02",
+	"January 2, 2006",
+	"January 2 2006",
+	"Jan 2, 2006",
+	"Jan. 2, 2006",
+	"Jan 2 2006",
+	"2 January 2006",
+	"2 Jan 2006",
+	"01/02/2006",
+	"1/2/2006",
+	"01/02/06",
+	"1/2/06",
+	"01-02-2006",
+	"2006.01.02",
+}
+
+var setNumbers = map[string]int{
+	"i": 1, "ii": 2, "iii": 3,
+	"one": 1, "two": 2, "three": 3,
+}
+
+// IsInfoFile reports whether the file at path is likely to be a show's info
+// file: a text file named like the show, its folder, or its shnid, or given
+// a generic name such as info.txt. Checksum files and ripping logs aren't.
+func IsInfoFile(path string) bool {
+	base := filepath.Base(path)
+	name, ok := strings.CutSuffix(strings.ToLower(base), ".txt")
+	if !ok || notInfoRegEx.MatchString(name) {
+		return false
+	}
+	return infoNameRegEx.MatchString(name) || strings.EqualFold(name, filepath.Base(filepath.Dir(path)))
+}
+
+// ParseInfo parses an info text file. Info files are free form, so parsing is
+// best effort: the header block at the top of the file supplies the artist,
+// date, venue, and city; "key: value" lines supply the recording details; and
+// numbered lines make up the setlist.
+func ParseInfo(r io.Reader) (*InfoText, error) {
+	info := &InfoText{}
+
+	disc, set := 0, 0
+	inHeader := true
+	headerLines := 0
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(ToUTF8(scanner.Bytes()))
+		if line == "" {
+			if headerLines > 0 {
+				inHeader = false
+			}
+			continue
+		}
+
+		if m := fieldRegEx.FindStringSubmatch(line); m != nil {
+			inHeader = false
+			info.setField(strings.ToLower(m[1]), strings.TrimSpace(m[2]))
+			continue
+		}
+
+		if m := discRegEx.FindStringSubmatch(line); m != nil {
+			inHeader = false
+			disc, _ = strconv.Atoi(m[1])
+			continue
+		}
+
+		if m := setRegEx.FindStringSubmatch(line); m != nil {
+			inHeader = false
+			set = parseSet(m[1], m[2], set)
+			continue
+		}
+
+		if m := songRegEx.FindStringSubmatch(line); m != nil && !isDate(line) {
+			inHeader = false
+			entry := SetlistEntry{Disc: disc, Set: set, Title: m[3]}
+			if m[1] != "" {
+				entry.Disc, _ = strconv.Atoi(m[1])
+			}
+			entry.Track, _ = strconv.Atoi(m[2])
+			if t := timeRegEx.FindStringSubmatch(entry.Title); t != nil {
+				entry.Duration = parseDuration(t[1])
+				entry.Title = strings.TrimSpace(strings.TrimSuffix(entry.Title, t[0]))
+			}
+			info.Setlist = append(info.Setlist, entry)
+			continue
+		}
+
+		if inHeader {
+			headerLines++
+			info.setHeaderLine(line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// Empty reports whether nothing useful was found in the info file.
+func (info *InfoText) Empty() bool {
+	return info.Artist == "" && info.Date.IsZero() && info.Venue == "" &&
+		info.Source == "" && info.Lineage == "" && len(info.Setlist) == 0
+}
+
+func (info *InfoText) setField(key, value string) {
+	switch key {
+	case "source", "src", "recording":
+		info.Source = cmp.Or(info.Source, value)
+	case "lineage":
+		info.Lineage = cmp.Or(info.Lineage, value)
+	case "taper", "taped by", "recorded by":
+		info.Taper = cmp.Or(info.Taper, value)
+	case "transfer", "transferred by":
+		info.Transfer = cmp.Or(info.Transfer, value)
+	case "venue", "location":
+		info.Venue = cmp.Or(info.Venue, value)
+	case "city":
+		info.City = cmp.Or(info.City, value)
+	}
+}
+
+func (info *InfoText) setHeaderLine(line string) {
+	if info.Date.IsZero() {
+		if date, ok := parseDate(line); ok {
+			info.Date = date
+			return
+		}
+	}
+
+	switch {
+	case info.Artist == "" && info.Date.IsZero():
+		info.Artist = line
+	case info.Venue == "":
+		info.Venue = line
+	case info.City == "" && cityRegEx.MatchString(line):
+		info.City = line
+	}
+}
+
+func parseSet(name, number string, current int) int {
+	lname := strings.ToLower(name)
+	if lname == "encore" || lname == "e" {
+		return current + 1
+	}
+
+	if n, err := strconv.Atoi(number); err == nil {
+		return n
+	}
+	return setNumbers[strings.ToLower(number)]
+}
+
+func isDate(line string) bool {
+	_, ok := parseDate(line)
+	return ok
+}
+
+func parseDate(line string) (time.Time, bool) {
+	value := dayRegEx.ReplaceAllString(strings.TrimSpace(line), "")
+	for _, layout := range dateLayouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			if !strings.Contains(layout, "2006") {
+				date = fixCentury(date)
+			}
+			return date, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func parseDuration(value string) time.Duration {
+	var d time.Duration
+	for _, part := range strings.Split(value, ":") {
+		n, _ := strconv.Atoi(part)
+		d = d*60 + time.Duration(n)
+	}
+	return d * time.Second
+}
+
+// ToUTF8 returns b as a string, treating it as Latin-1 if it isn't valid
+// UTF-8. Info files written on older systems are rarely UTF-8.
+func ToUTF8(b []byte) string {
+	b = []byte(strings.TrimPrefix(string(b), "\uFEFF"))
+	if utf8.Valid(b) {
+		return string(b)
+	}
+
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
@@ -0,0 +1,119 @@
+package etree
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseInfo(t *testing.T) {
+	text := `Grateful Dead
+May 8, 1977
+Barton Hall, Cornell University
+Ithaca, NY
+
+Source: SBD > Reel > DAT
+Lineage: DAT > CD > EAC > FLAC
+Taper: Betty Cantor-Jackson
+
+Disc 1
+Set 1
+01. Minglewood Blues [5:12]
+02. Loser (7:08)
+
+Set 2
+d2t01. Scarlet Begonias 11:23
+d2t02 Fire On The Mountain
+Encore
+d2t03. One More Saturday Night
+`
+	want := &InfoText{
+		Artist:  "Grateful Dead",
+		Date:    date(1977, 5, 8),
+		Venue:   "Barton Hall, Cornell University",
+		City:    "Ithaca, NY",
+		Source:  "SBD > Reel > DAT",
+		Lineage: "DAT > CD > EAC > FLAC",
+		Taper:   "Betty Cantor-Jackson",
+		Setlist: []SetlistEntry{
+			{Disc: 1, Set: 1, Track: 1, Title: "Minglewood Blues", Duration: 5*time.Minute + 12*time.Second},
+			{Disc: 1, Set: 1, Track: 2, Title: "Loser", Duration: 7*time.Minute + 8*time.Second},
+			{Disc: 2, Set: 2, Track: 1, Title: "Scarlet Begonias", Duration: 11*time.Minute + 23*time.Second},
+			{Disc: 2, Set: 2, Track: 2, Title: "Fire On The Mountain"},
+			{Disc: 2, Set: 3, Track: 3, Title: "One More Saturday Night"},
+		},
+	}
+
+	got, err := ParseInfo(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("ParseInfo() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseInfo() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseInfoLatin1(t *testing.T) {
+	got, err := ParseInfo(strings.NewReader("Los Lobos\n1988-02-05\nCaf\xe9 Wha?\n"))
+	if err != nil {
+		t.Fatalf("ParseInfo() error = %v", err)
+	}
+	if want := "Café Wha?"; got.Venue != want {
+		t.Errorf("ParseInfo() venue = %q, want %q", got.Venue, want)
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		line string
+		want time.Time
+	}{
+		{"1977-05-08", date(1977, 5, 8)},
+		{"May 8, 1977", date(1977, 5, 8)},
+		{"Sunday, May 8, 1977", date(1977, 5, 8)},
+		{"8 May 1977", date(1977, 5, 8)},
+		{"05/08/1977", date(1977, 5, 8)},
+		{"5/19/66", date(1966, 5, 19)},
+		{"10/12/68", date(1968, 10, 12)},
+		{"7/29/03", date(2003, 7, 29)},
+	}
+	for _, tt := range tests {
+		got, ok := parseDate(tt.line)
+		if !ok || !got.Equal(tt.want) {
+			t.Errorf("parseDate(%q) = %v, %t, want %v", tt.line, got, ok, tt.want)
+		}
+	}
+
+	if got, ok := parseDate("Barton Hall"); ok {
+		t.Errorf("parseDate(%q) = %v, want no date", "Barton Hall", got)
+	}
+}
+
+func TestIsInfoFile(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/music/gd1977-05-08.sbd/gd77-05-08.txt", true},
+		{"/music/gd1977-05-08.sbd/gd1977-05-08.sbd.miller.12345.txt", true},
+		{"/music/gd1977-05-08.sbd/12345.txt", true},
+		{"/music/gd1977-05-08.sbd/info.txt", true},
+		{"/music/gd1977-05-08.sbd/Show Notes.TXT", true},
+		{"/music/Cornell 77/cornell 77.txt", true},
+		{"/music/show.zip!/gd1977-05-08.sbd/gd77-05-08.txt", true},
+		{"/music/gd1977-05-08.sbd/gd77-05-08.ffp.txt", false},
+		{"/music/gd1977-05-08.sbd/gd77-05-08.md5.txt", false},
+		{"/music/gd1977-05-08.sbd/ffp.txt", false},
+		{"/music/gd1977-05-08.sbd/checksums.txt", false},
+		{"/music/gd1977-05-08.sbd/gd77-05-08_eac.txt", false},
+		{"/music/gd1977-05-08.sbd/lyrics.txt", false},
+		{"/music/gd1977-05-08.sbd/gd77-05-08.md5", false},
+		{"/music/gd1977-05-08.sbd/Shakedown Street notes.txt", true},
+	}
+	for _, tt := range tests {
+		if got := IsInfoFile(tt.path); got != tt.want {
+			t.Errorf("IsInfoFile(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// Package etree parses folder and file names that follow the etree.org
+// naming convention, such as gd1977-05-08.sbd.miller.97375.flac16/gd77-05-08d1t01.flac.
+package etree
+
+import (
+	"cmp"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Info holds the fields parsed out of a folder and file name. Fields that
+// could not be found are left at their zero value.
+type Info struct {
+	ArtistAbbrev string
+	Artist       string
+	Date         time.Time
+	Source       string
+	Taper        string
+	Shnid        string
+	BitDepth     int
+	Disc         int
+	Set          int
+	Track        int
+}
+
+// sourceTypes are the recording source types recognized in folder names.
+var sourceTypes = map[string]string{
+	"aud":        "aud",
+	"dsbd":       "sbd",
+	"fm":         "fm",
+	"matrix":     "mtx",
+	"mtx":        "mtx",
+	"pre-fm":     "fm",
+	"sbd":        "sbd",
+	"soundboard": "sbd",
+}
+
+var (
+	dateRegEx     = regexp.MustCompile(`^(\d{4}|\d{2})-(\d{2})-(\d{2})`)
+	bitDepthRegEx = regexp.MustCompile(`^flac(16|24)`)
+	shnidRegEx    = regexp.MustCompile(`^\d{3,}$`)
+	trackRegEx    = regexp.MustCompile(`^(?:(?:d|cd|disc)(\d+)|s(\d+))?t(?:rack)?(\d+)`)
+	numberRegEx   = regexp.MustCompile(`^(\d{1,3})[ ._-]`)
+)
+
+// containerTokens are folder name tokens that describe the file format
+// rather than the recording.
+var containerTokens = []string{"flac", "shn", "shnf", "mp3", "ape", "wv"}
+
+type Parser struct {
+	artists ArtistTable
+}
+
+func NewParser(artists ArtistTable) *Parser {
+	return &Parser{artists: artists}
+}
+
+// Parse extracts show and track information from the name of a file and the
+// folder containing it. Fields found in the file name take precedence over
+// fields found in the folder name.
+func (p *Parser) Parse(path string) Info {
+	info := p.ParseFolder(filepath.Base(filepath.Dir(path)))
+	file := p.ParseFile(filepath.Base(path))
+
+	if file.ArtistAbbrev != "" && info.ArtistAbbrev == "" {
+		info.ArtistAbbrev = file.ArtistAbbrev
+		info.Artist = file.Artist
+	}
+	// File names usually have two digit years, so the folder's year is kept
+	// when they agree on the rest of the date.
+	if !file.Date.IsZero() && (info.Date.IsZero() || !sameDate(info.Date, file.Date)) {
+		info.Date = file.Date
+	}
+	info.Disc = file.Disc
+	info.Set = file.Set
+	info.Track = file.Track
+
+	return info
+}
+
+// ParseFolder parses a folder name such as gd1977-05-08.sbd.miller.97375.flac16.
+func (p *Parser) ParseFolder(name string) Info {
+	info := Info{}
+
+	rest := p.parsePrefix(strings.ToLower(name), &info)
+	if info.Date.IsZero() {
+		return Info{}
+	}
+
+	for _, token := range strings.FieldsFunc(rest, func(r rune) bool { return r == '.' || r == '_' }) {
+		if source, ok := sourceTypes[token]; ok {
+			info.Source = cmp.Or(info.Source, source)
+		} else if m := bitDepthRegEx.FindStringSubmatch(token); m != nil {
+			info.BitDepth, _ = strconv.Atoi(m[1])
+		} else if shnidRegEx.MatchString(token) {
+			info.Shnid = cmp.Or(info.Shnid, token)
+		} else if slices.Contains(containerTokens, token) {
+			continue
+		} else if info.Taper == "" && info.Source != "" {
+			// The taper, when present, follows the source type.
+			info.Taper = token
+		}
+	}
+
+	return info
+}
+
+// ParseFile parses a file name such as gd77-05-08d1t01.flac.
+func (p *Parser) ParseFile(name string) Info {
+	info := Info{}
+
+	base := strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))
+	rest := p.parsePrefix(base, &info)
+
+	if m := trackRegEx.FindStringSubmatch(strings.TrimLeft(rest, "._- ")); m != nil {
+		info.Disc, _ = strconv.Atoi(m[1])
+		info.Set, _ = strconv.Atoi(m[2])
+		info.Track, _ = strconv.Atoi(m[3])
+	} else if info.Date.IsZero() {
+		// Fall back to names such as "01 Bertha.flac"
+		if m := numberRegEx.FindStringSubmatch(base); m != nil {
+			info.Track, _ = strconv.Atoi(m[1])
+		}
+	}
+
+	return info
+}
+
+// parsePrefix parses the artist abbreviation and date at the start of name
+// and returns the remainder of the name.
+func (p *Parser) parsePrefix(name string, info *Info) string {
+	abbr := p.matchArtist(name)
+	rest := name[len(abbr):]
+
+	m := dateRegEx.FindStringSubmatch(rest)
+	if m == nil {
+		return name
+	}
+
+	layout := "2006-01-02"
+	if len(m[1]) == 2 {
+		layout = "06-01-02"
+	}
+	date, err := time.Parse(layout, m[0])
+	if err != nil {
+		return name
+	}
+	if len(m[1]) == 2 {
+		date = fixCentury(date)
+	}
+
+	info.ArtistAbbrev = abbr
+	info.Artist = p.artists[abbr]
+	info.Date = date
+	return rest[len(m[0]):]
+}
+
+// fixCentury moves a date parsed from a two digit year into 1950 to 2049,
+// instead of the 1969 to 2068 that time.Parse uses, as live recordings from
+// the 1950s and 60s are far more likely than ones from the future.
+func fixCentury(date time.Time) time.Time {
+	if date.Year() >= 2050 {
+		return date.AddDate(-100, 0, 0)
+	}
+	return date
+}
+
+// sameDate reports whether a and b are the same day, apart from the century.
+func sameDate(a, b time.Time) bool {
+	return a.Year()%100 == b.Year()%100 && a.Month() == b.Month() && a.Day() == b.Day()
+}
+
+// matchArtist returns the artist abbreviation at the start of name. Known
+// abbreviations are preferred, longest first, so that abbreviations
+// containing digits, such as sts9, are handled.
+func (p *Parser) matchArtist(name string) string {
+	best := ""
+	for abbr := range p.artists {
+		if len(abbr) > len(best) && strings.HasPrefix(name, abbr) && dateRegEx.MatchString(name[len(abbr):]) {
+			best = abbr
+		}
+	}
+	if best != "" {
+		return best
+	}
+
+	i := strings.IndexFunc(name, func(r rune) bool { return r < 'a' || r > 'z' })
+	if i < 0 {
+		return ""
+	}
+	return name[:i]
+}
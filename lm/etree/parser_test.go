@@ -0,0 +1,94 @@
+package etree
+
+import (
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		path string
+		want Info
+	}{
+		{
+			path: "gd1977-05-08.sbd.hicks.4982.sbeok.shnf/gd77-05-08d1t01.shn",
+			want: Info{ArtistAbbrev: "gd", Artist: "Grateful Dead", Date: date(1977, 5, 8), Source: "sbd", Taper: "hicks", Shnid: "4982", Disc: 1, Track: 1},
+		},
+		{
+			path: "gd1966-01-08.aud.unknown.85633.flac16/gd66-01-08d1t02.flac",
+			want: Info{ArtistAbbrev: "gd", Artist: "Grateful Dead", Date: date(1966, 1, 8), Source: "aud", Taper: "unknown", Shnid: "85633", BitDepth: 16, Disc: 1, Track: 2},
+		},
+		{
+			path: "gd68-02-14.sbd.miller.1234.flac16/gd68-02-14d2t05.flac",
+			want: Info{ArtistAbbrev: "gd", Artist: "Grateful Dead", Date: date(1968, 2, 14), Source: "sbd", Taper: "miller", Shnid: "1234", BitDepth: 16, Disc: 2, Track: 5},
+		},
+		{
+			path: "ph1997-11-22.sbd.unknown.12345.flac24/ph97-11-22s2t03.flac",
+			want: Info{ArtistAbbrev: "ph", Artist: "Phish", Date: date(1997, 11, 22), Source: "sbd", Taper: "unknown", Shnid: "12345", BitDepth: 24, Set: 2, Track: 3},
+		},
+		{
+			path: "sts92005-12-31.mtx.flac16/sts905-12-31d1t04.flac",
+			want: Info{ArtistAbbrev: "sts9", Artist: "Sound Tribe Sector 9", Date: date(2005, 12, 31), Source: "mtx", BitDepth: 16, Disc: 1, Track: 4},
+		},
+		{
+			path: "wsp2001-04-20.pre-fm.flac/wsp2001-04-20t12.flac",
+			want: Info{ArtistAbbrev: "wsp", Artist: "Widespread Panic", Date: date(2001, 4, 20), Source: "fm", Track: 12},
+		},
+		{
+			// The folder's four digit year is kept over the file's two digit
+			// one, which would otherwise be in the 2040s
+			path: "bm1940-06-01.aud/bm40-06-01t01.flac",
+			want: Info{ArtistAbbrev: "bm", Date: date(1940, 6, 1), Source: "aud", Track: 1},
+		},
+		{
+			path: "Grateful Dead - Barton Hall/01 Bertha.flac",
+			want: Info{Track: 1},
+		},
+		{
+			path: "gd77-05-08.sbd/gd77-05-09t01.flac",
+			want: Info{ArtistAbbrev: "gd", Artist: "Grateful Dead", Date: date(1977, 5, 9), Source: "sbd", Track: 1},
+		},
+	}
+
+	p := NewParser(DefaultArtists())
+	for _, tt := range tests {
+		if got := p.Parse(tt.path); got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestParseFolderWithoutDate(t *testing.T) {
+	p := NewParser(DefaultArtists())
+	for _, name := range []string{"Grateful Dead", "flac16", "gd-sbd-1977"} {
+		if got := p.ParseFolder(name); got != (Info{}) {
+			t.Errorf("ParseFolder(%q) = %+v, want no fields", name, got)
+		}
+	}
+}
+
+func TestTwoDigitYears(t *testing.T) {
+	tests := []struct {
+		name string
+		want time.Time
+	}{
+		{"gd66-05-19", date(1966, 5, 19)},
+		{"gd68-10-12", date(1968, 10, 12)},
+		{"gd69-02-27", date(1969, 2, 27)},
+		{"gd95-07-09", date(1995, 7, 9)},
+		{"ph03-07-29", date(2003, 7, 29)},
+		{"um49-12-31", date(2049, 12, 31)},
+		{"bm50-01-01", date(1950, 1, 1)},
+	}
+
+	p := NewParser(DefaultArtists())
+	for _, tt := range tests {
+		if got := p.ParseFolder(tt.name).Date; !got.Equal(tt.want) {
+			t.Errorf("ParseFolder(%q).Date = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
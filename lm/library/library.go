@@ -0,0 +1,106 @@
+// Package library identifies tracks by the library root they were found in
+// and their path relative to it, plus a hash of their audio content. The
+// relative path keeps two sources of the same show with identical file names
+// apart, and the root keeps the same path in two libraries apart. The content
+// hash ignores tags, so retagging a file doesn't change its identity, while
+// replacing the audio does.
+package library
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/organicveggie/livemusic/lm/audio/formats"
+)
+
+// Library is the set of library roots that relative paths are computed from.
+type Library struct {
+	roots []string
+}
+
+func New(roots []string) *Library {
+	l := &Library{}
+	for _, root := range roots {
+		if abs, err := filepath.Abs(root); err == nil {
+			root = abs
+		}
+		l.roots = append(l.roots, filepath.Clean(root))
+	}
+	return l
+}
+
+// Roots returns the absolute paths of the library roots.
+func (l *Library) Roots() []string {
+	return l.roots
+}
+
+// RelPath returns the library root containing path and the slash separated
+// path relative to it. fallback, if set, is used as the root when none of the
+// library roots contain path. Paths outside every root are relative to the
+// file system root.
+func (l *Library) RelPath(path, fallback string) (string, string) {
+	best := ""
+	for _, root := range l.roots {
+		if len(root) > len(best) && (path == root || strings.HasPrefix(path, root+string(filepath.Separator))) {
+			best = root
+		}
+	}
+	if fallback = filepath.Clean(fallback); best == "" && fallback != "." && strings.HasPrefix(path, fallback+string(filepath.Separator)) {
+		best = fallback
+	}
+	if best == "" {
+		return "", filepath.ToSlash(strings.TrimPrefix(path, string(filepath.Separator)))
+	}
+
+	rel, err := filepath.Rel(best, path)
+	if err != nil {
+		return "", filepath.ToSlash(path)
+	}
+	return best, filepath.ToSlash(rel)
+}
+
+// Files maps the name of each file in the library roots to their paths.
+// Folders that can't be read are left out.
+func (l *Library) Files() (map[string][]string, error) {
+	files := map[string][]string{}
+	for _, root := range l.roots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrPermission) {
+					return nil
+				}
+				return err
+			}
+			if d.Type().IsRegular() {
+				files[d.Name()] = append(files[d.Name()], path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error listing library root %s: %v", root, err)
+		}
+	}
+	return files, nil
+}
+
+// TrackId returns the identifier of a track.
+func TrackId(libraryRoot, relPath, contentHash string) string {
+	return fmt.Sprintf("%x", sha1.Sum([]byte(libraryRoot+"\n"+relPath+"\n"+contentHash)))
+}
+
+// ContentHash returns a hash of the audio in a file that ignores any tags.
+// FLAC files use the MD5 signature of the decoded audio. Other files use a
+// SHA-1 of the audio without its tags, where the format allows telling them
+// apart.
+func ContentHash(rs io.ReadSeeker, format *formats.Format, filename string) (string, error) {
+	sum, err := format.ContentHash(rs)
+	if err != nil {
+		return "", fmt.Errorf("error hashing %s: %v", filename, err)
+	}
+	return sum, nil
+}
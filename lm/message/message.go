@@ -0,0 +1,79 @@
+// Package message defines the messages that scan sends to analyze, through a
+// queue or a file list.
+package message
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Version is the current version of the File envelope. Decode rejects
+// envelopes from newer versions rather than misreading them. Version 2 added
+// the event.
+const Version = 2
+
+// Event is what a scan found out about a file.
+type Event string
+
+const (
+	// EventFound is a new or changed file. Messages without an event, such
+	// as bare paths and version 1 envelopes, are found files.
+	EventFound Event = "found"
+	// EventRemoved is a file seen by a previous scan that no longer exists.
+	EventRemoved Event = "removed"
+)
+
+// File describes a file found by a scan. The size and modification time are
+// as of the scan, or for removed files, as of the scan that last saw them.
+type File struct {
+	Version     int       `json:"version"`
+	Event       Event     `json:"event,omitempty"`
+	Path        string    `json:"path"`
+	LibraryRoot string    `json:"library_root,omitempty"`
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mod_time"`
+	Host        string    `json:"host,omitempty"`
+	ScanId      string    `json:"scan_id,omitempty"`
+}
+
+// Encode returns the JSON envelope for f.
+func Encode(f *File) (string, error) {
+	f.Version = Version
+	if f.Event == "" {
+		f.Event = EventFound
+	}
+	b, err := json.Marshal(f)
+	if err != nil {
+		return "", fmt.Errorf("error encoding message for %s: %v", f.Path, err)
+	}
+	return string(b), nil
+}
+
+// Decode parses a message body, which is either a JSON envelope or, as sent
+// by older scans, a bare path.
+func Decode(body string) (*File, error) {
+	body = strings.TrimSpace(body)
+	if !strings.HasPrefix(body, "{") {
+		if body == "" {
+			return nil, fmt.Errorf("empty message")
+		}
+		return &File{Event: EventFound, Path: body}, nil
+	}
+
+	f := &File{}
+	if err := json.Unmarshal([]byte(body), f); err != nil {
+		return nil, fmt.Errorf("error decoding message %q: %v", body, err)
+	}
+	if f.Version > Version {
+		return nil, fmt.Errorf("unsupported message version %d for %s", f.Version, f.Path)
+	}
+	if f.Path == "" {
+		return nil, fmt.Errorf("message %q has no path", body)
+	}
+	if f.Event == "" {
+		f.Event = EventFound
+	}
+	return f, nil
+}
@@ -0,0 +1,240 @@
+// Package mongoqueue is a work queue stored in a MongoDB collection, for
+// passing files from scan to analyze without AWS.
+//
+// Messages are leased rather than removed when they're received. A leased
+// message is hidden from other consumers until its lease expires, so that a
+// consumer that dies doesn't lose it. Consumers extend the lease of slow
+// messages and mark them done, or failed, once they've been handled.
+package mongoqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	databaseName   = "lm"
+	collectionName = "queue"
+)
+
+// Status is the state of a message.
+type Status string
+
+const (
+	StatusPending Status = "pending"
+	StatusLeased  Status = "leased"
+	StatusDone    Status = "done"
+	StatusFailed  Status = "failed"
+)
+
+// Message is a message in a queue. Attempts counts the times it has been
+// leased, including the current lease.
+type Message struct {
+	Id        bson.ObjectID `bson:"_id,omitempty"`
+	Queue     string        `bson:"queue"`
+	Body      string        `bson:"body"`
+	Status    Status        `bson:"status"`
+	Attempts  int           `bson:"attempts"`
+	VisibleAt time.Time     `bson:"visible_at"`
+	LeaseId   string        `bson:"lease_id,omitempty"`
+	Error     string        `bson:"error,omitempty"`
+	CreatedAt time.Time     `bson:"created_at"`
+	UpdatedAt time.Time     `bson:"updated_at"`
+}
+
+// Queue is a named queue. Several queues can share the collection.
+type Queue struct {
+	name       string
+	client     *mongo.Client
+	collection *mongo.Collection
+}
+
+// Open connects to the queue with the given name.
+func Open(ctx context.Context, mongoURI, name string) (*Queue, error) {
+	client, err := mongo.Connect(options.Client().ApplyURI(mongoURI))
+	if err != nil {
+		return nil, fmt.Errorf("error establishing connection to MongoDB at %q: %v", mongoURI, err)
+	}
+
+	q := &Queue{
+		name:       name,
+		client:     client,
+		collection: client.Database(databaseName).Collection(collectionName),
+	}
+	index := mongo.IndexModel{Keys: bson.D{
+		{Key: "queue", Value: 1},
+		{Key: "status", Value: 1},
+		{Key: "visible_at", Value: 1},
+	}}
+	if _, err := q.collection.Indexes().CreateOne(ctx, index); err != nil {
+		client.Disconnect(ctx)
+		return nil, fmt.Errorf("error creating index on queue %s: %v", name, err)
+	}
+	return q, nil
+}
+
+func (q *Queue) Name() string {
+	return q.name
+}
+
+func (q *Queue) Close(ctx context.Context) error {
+	return q.client.Disconnect(ctx)
+}
+
+// Push adds messages to the queue.
+func (q *Queue) Push(ctx context.Context, bodies []string) error {
+	if len(bodies) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	docs := make([]*Message, 0, len(bodies))
+	for _, body := range bodies {
+		docs = append(docs, &Message{
+			Queue:     q.name,
+			Body:      body,
+			Status:    StatusPending,
+			VisibleAt: now,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+	}
+	if _, err := q.collection.InsertMany(ctx, docs); err != nil {
+		return fmt.Errorf("error adding %d messages to queue %s: %v", len(bodies), q.name, err)
+	}
+	return nil
+}
+
+// Lease returns the next visible message, hiding it from other consumers for
+// the visibility timeout, or nil if there isn't one. Messages whose lease
+// has expired are visible again, unless they've already been leased
+// maxAttempts times, in which case they're marked failed instead, as their
+// consumer likely died handling them.
+func (q *Queue) Lease(ctx context.Context, visibility time.Duration, maxAttempts int) (*Message, error) {
+	now := time.Now().UTC()
+	if err := q.failExpired(ctx, now, maxAttempts); err != nil {
+		return nil, err
+	}
+
+	filter := bson.D{
+		{Key: "queue", Value: q.name},
+		{Key: "status", Value: bson.D{{Key: "$in", Value: bson.A{StatusPending, StatusLeased}}}},
+		{Key: "visible_at", Value: bson.D{{Key: "$lte", Value: now}}},
+		{Key: "attempts", Value: bson.D{{Key: "$lt", Value: maxAttempts}}},
+	}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "status", Value: StatusLeased},
+			{Key: "visible_at", Value: now.Add(visibility)},
+			{Key: "lease_id", Value: bson.NewObjectID().Hex()},
+			{Key: "updated_at", Value: now},
+		}},
+		{Key: "$inc", Value: bson.D{{Key: "attempts", Value: 1}}},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "visible_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	m := &Message{}
+	if err := q.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(m); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error leasing message from queue %s: %v", q.name, err)
+	}
+	return m, nil
+}
+
+// failExpired marks the messages whose lease expired after maxAttempts or
+// more attempts as failed.
+func (q *Queue) failExpired(ctx context.Context, now time.Time, maxAttempts int) error {
+	filter := bson.D{
+		{Key: "queue", Value: q.name},
+		{Key: "status", Value: StatusLeased},
+		{Key: "visible_at", Value: bson.D{{Key: "$lte", Value: now}}},
+		{Key: "attempts", Value: bson.D{{Key: "$gte", Value: maxAttempts}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "status", Value: StatusFailed},
+		{Key: "error", Value: fmt.Sprintf("lease expired after %d attempts", maxAttempts)},
+		{Key: "updated_at", Value: now},
+	}}}
+	if _, err := q.collection.UpdateMany(ctx, filter, update); err != nil {
+		return fmt.Errorf("error failing expired messages in queue %s: %v", q.name, err)
+	}
+	return nil
+}
+
+// Extend keeps m hidden for another visibility timeout.
+func (q *Queue) Extend(ctx context.Context, m *Message, visibility time.Duration) error {
+	now := time.Now().UTC()
+	return q.update(ctx, m, "extending lease of", bson.D{
+		{Key: "visible_at", Value: now.Add(visibility)},
+		{Key: "updated_at", Value: now},
+	})
+}
+
+// Complete marks m as done.
+func (q *Queue) Complete(ctx context.Context, m *Message) error {
+	return q.update(ctx, m, "completing", bson.D{
+		{Key: "status", Value: StatusDone},
+		{Key: "updated_at", Value: time.Now().UTC()},
+	})
+}
+
+// Retry makes m visible again after delay to be retried, recording the error
+// that it failed with.
+func (q *Queue) Retry(ctx context.Context, m *Message, cause error, delay time.Duration) error {
+	now := time.Now().UTC()
+	return q.update(ctx, m, "releasing", bson.D{
+		{Key: "status", Value: StatusPending},
+		{Key: "visible_at", Value: now.Add(delay)},
+		{Key: "error", Value: cause.Error()},
+		{Key: "updated_at", Value: now},
+	})
+}
+
+// Release makes m visible again without counting the attempt, for consumers
+// that only looked at it.
+func (q *Queue) Release(ctx context.Context, m *Message) error {
+	now := time.Now().UTC()
+	return q.update(ctx, m, "releasing", bson.D{
+		{Key: "status", Value: StatusPending},
+		{Key: "attempts", Value: m.Attempts - 1},
+		{Key: "visible_at", Value: now},
+		{Key: "updated_at", Value: now},
+	})
+}
+
+// Fail marks m as failed, so that it's no longer retried, recording the
+// error that it failed with.
+func (q *Queue) Fail(ctx context.Context, m *Message, cause error) error {
+	return q.update(ctx, m, "failing", bson.D{
+		{Key: "status", Value: StatusFailed},
+		{Key: "error", Value: cause.Error()},
+		{Key: "updated_at", Value: time.Now().UTC()},
+	})
+}
+
+// update sets fields on m as long as it's still leased by this consumer. A
+// lease that expired and was taken by another consumer is left alone.
+func (q *Queue) update(ctx context.Context, m *Message, action string, set bson.D) error {
+	filter := bson.D{
+		{Key: "_id", Value: m.Id},
+		{Key: "lease_id", Value: m.LeaseId},
+	}
+	result, err := q.collection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: set}})
+	if err != nil {
+		return fmt.Errorf("error %s message %s in queue %s: %v", action, m.Id.Hex(), q.name, err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("error %s message %s in queue %s: lease expired", action, m.Id.Hex(), q.name)
+	}
+	return nil
+}
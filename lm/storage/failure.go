@@ -0,0 +1,23 @@
+package storage
+
+import "time"
+
+// FailureReason categorizes why a file couldn't be analyzed.
+type FailureReason string
+
+const (
+	FailureOpen        FailureReason = "open_error"
+	FailureUnsupported FailureReason = "unsupported_format"
+	FailureTags        FailureReason = "tag_parse_error"
+	FailureRead        FailureReason = "read_error"
+	FailureStorage     FailureReason = "storage_error"
+)
+
+// Failure records a file that couldn't be analyzed. The failures collection
+// holds the latest failure of each file, keyed by path.
+type Failure struct {
+	Path     string        `json:"path" bson:"_id"`
+	Reason   FailureReason `json:"reason" bson:"reason"`
+	Error    string        `json:"error" bson:"error"`
+	FailedAt time.Time     `json:"failed_at" bson:"failed_at"`
+}
@@ -0,0 +1,38 @@
+package storage
+
+import "time"
+
+// InfoFile is an info text file parsed from a show folder.
+type InfoFile struct {
+	Id       string         `json:"id" bson:"_id"`
+	Filename string         `json:"filename" bson:"filename"`
+	Folder   string         `json:"folder" bson:"folder"`
+	Artist   string         `json:"artist" bson:"artist,omitempty"`
+	Date     time.Time      `json:"date" bson:"date,omitempty"`
+	Venue    string         `json:"venue" bson:"venue,omitempty"`
+	City     string         `json:"city" bson:"city,omitempty"`
+	Source   string         `json:"source" bson:"source,omitempty"`
+	Lineage  string         `json:"lineage" bson:"lineage,omitempty"`
+	Taper    string         `json:"taper" bson:"taper,omitempty"`
+	Transfer string         `json:"transfer" bson:"transfer,omitempty"`
+	Setlist  []SetlistEntry `json:"setlist" bson:"setlist,omitempty"`
+}
+
+type SetlistEntry struct {
+	Disc     int           `json:"disc" bson:"disc,omitempty"`
+	Set      int           `json:"set" bson:"set,omitempty"`
+	Track    int           `json:"track" bson:"track"`
+	Title    string        `json:"title" bson:"title"`
+	Duration time.Duration `json:"duration" bson:"duration,omitempty"`
+}
+
+// SetlistEntryFor returns the setlist entry for a disc and track number.
+// Entries without a disc number only match by track number.
+func (info *InfoFile) SetlistEntryFor(disc, track int) (SetlistEntry, bool) {
+	for _, e := range info.Setlist {
+		if e.Track == track && (e.Disc == disc || e.Disc == 0 || disc == 0) {
+			return e, true
+		}
+	}
+	return SetlistEntry{}, false
+}
@@ -0,0 +1,239 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Mongo stores documents in MongoDB collections.
+type Mongo struct {
+	mongoURI   string
+	client     *mongo.Client
+	db         *mongo.Database
+	collection *mongo.Collection
+	shows      *mongo.Collection
+	info       *mongo.Collection
+	failures   *mongo.Collection
+	meta       *mongo.Collection
+}
+
+func newMongo(mongoURI string) (*Mongo, error) {
+	h := Mongo{
+		mongoURI: mongoURI,
+	}
+
+	var err error
+	h.client, err = mongo.Connect(options.Client().ApplyURI(mongoURI))
+	if err != nil {
+		return nil, fmt.Errorf("error establishing connection to MongoDB at %q: %v", mongoURI, err)
+	}
+
+	h.db = h.client.Database(databaseName)
+	h.collection = h.db.Collection(collectionName)
+	h.shows = h.db.Collection(showsCollectionName)
+	h.info = h.db.Collection(infoCollectionName)
+	h.failures = h.db.Collection(failuresCollectionName)
+	h.meta = h.db.Collection(metaCollectionName)
+
+	return &h, nil
+}
+
+func (sh *Mongo) Close(ctx context.Context) error {
+	return sh.client.Disconnect(ctx)
+}
+
+// Database returns the lm database, for setting up its collections.
+func (sh *Mongo) Database() *mongo.Database {
+	return sh.db
+}
+
+func newSaveResult(result *mongo.UpdateResult) SaveResult {
+	switch {
+	case result.UpsertedCount > 0:
+		return SaveInserted
+	case result.ModifiedCount > 0:
+		return SaveUpdated
+	default:
+		return SaveUnchanged
+	}
+}
+
+func (sh *Mongo) SaveMetadata(ctx context.Context, metadata *Metadata) (SaveResult, error) {
+	opts := options.Replace().SetUpsert(true)
+	result, err := sh.collection.ReplaceOne(ctx, bson.D{{Key: "_id", Value: metadata.Id}}, metadata, opts)
+	if err != nil {
+		return SaveUnchanged, fmt.Errorf("error saving metadata to MongoDB: %v", err)
+	}
+	return newSaveResult(result), nil
+}
+
+func (sh *Mongo) FindTrackByRelPath(ctx context.Context, libraryRoot, relPath string) (*Metadata, error) {
+	// Tracks outside every library root are saved without one, which null
+	// matches
+	var root any
+	if libraryRoot != "" {
+		root = libraryRoot
+	}
+	filter := bson.D{{Key: "library_root", Value: root}, {Key: "rel_path", Value: relPath}}
+
+	track := &Metadata{}
+	if err := sh.collection.FindOne(ctx, filter).Decode(track); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error finding track %s: %v", relPath, err)
+	}
+	return track, nil
+}
+
+func (sh *Mongo) FindLegacyTracks(ctx context.Context) ([]*Metadata, error) {
+	cursor, err := sh.collection.Find(ctx, bson.D{{Key: "rel_path", Value: bson.D{{Key: "$exists", Value: false}}}})
+	if err != nil {
+		return nil, fmt.Errorf("error finding legacy tracks: %v", err)
+	}
+
+	tracks := []*Metadata{}
+	if err := cursor.All(ctx, &tracks); err != nil {
+		return nil, fmt.Errorf("error reading legacy tracks: %v", err)
+	}
+	return tracks, nil
+}
+
+func (sh *Mongo) DeleteTrack(ctx context.Context, id string) error {
+	if _, err := sh.collection.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}}); err != nil {
+		return fmt.Errorf("error deleting track %s from MongoDB: %v", id, err)
+	}
+	return nil
+}
+
+func (sh *Mongo) FindTracksByFolder(ctx context.Context, folder string) ([]*Metadata, error) {
+	cursor, err := sh.collection.Find(ctx, bson.D{{Key: "folder", Value: folder}})
+	if err != nil {
+		return nil, fmt.Errorf("error finding tracks in %s: %v", folder, err)
+	}
+
+	tracks := []*Metadata{}
+	if err := cursor.All(ctx, &tracks); err != nil {
+		return nil, fmt.Errorf("error reading tracks in %s: %v", folder, err)
+	}
+	return tracks, nil
+}
+
+func (sh *Mongo) SaveVerification(ctx context.Context, folder, filename string, v *Verification) (int64, error) {
+	filter := bson.D{{Key: "folder", Value: folder}, {Key: "filename", Value: filename}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "verification", Value: v}}}}
+	result, err := sh.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, fmt.Errorf("error recording verification of %s in %s: %v", filename, folder, err)
+	}
+	return result.ModifiedCount, nil
+}
+
+func (sh *Mongo) FindShowsByFolder(ctx context.Context, folder string) ([]*Show, error) {
+	cursor, err := sh.shows.Find(ctx, bson.D{{Key: "folder", Value: folder}})
+	if err != nil {
+		return nil, fmt.Errorf("error finding shows in %s: %v", folder, err)
+	}
+
+	shows := []*Show{}
+	if err := cursor.All(ctx, &shows); err != nil {
+		return nil, fmt.Errorf("error reading shows in %s: %v", folder, err)
+	}
+	return shows, nil
+}
+
+func (sh *Mongo) ReplaceShows(ctx context.Context, folder string, shows []*Show) error {
+	if _, err := sh.shows.DeleteMany(ctx, bson.D{{Key: "folder", Value: folder}}); err != nil {
+		return fmt.Errorf("error removing shows in %s from MongoDB: %v", folder, err)
+	}
+	if len(shows) == 0 {
+		return nil
+	}
+	if _, err := sh.shows.InsertMany(ctx, shows); err != nil {
+		return fmt.Errorf("error saving shows in %s to MongoDB: %v", folder, err)
+	}
+	return nil
+}
+
+func (sh *Mongo) SaveInfo(ctx context.Context, info *InfoFile) (SaveResult, error) {
+	opts := options.Replace().SetUpsert(true)
+	result, err := sh.info.ReplaceOne(ctx, bson.D{{Key: "_id", Value: info.Id}}, info, opts)
+	if err != nil {
+		return SaveUnchanged, fmt.Errorf("error saving info file to MongoDB: %v", err)
+	}
+	return newSaveResult(result), nil
+}
+
+func (sh *Mongo) DeleteInfo(ctx context.Context, id string) (SaveResult, error) {
+	result, err := sh.info.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return SaveUnchanged, fmt.Errorf("error deleting info file %s from MongoDB: %v", id, err)
+	}
+	if result.DeletedCount == 0 {
+		return SaveUnchanged, nil
+	}
+	return SaveRemoved, nil
+}
+
+func (sh *Mongo) FindInfoByFolder(ctx context.Context, folder string) (*InfoFile, error) {
+	opts := options.FindOne().SetSort(bson.D{{Key: "filename", Value: 1}})
+	result := sh.info.FindOne(ctx, bson.D{{Key: "folder", Value: folder}}, opts)
+
+	info := &InfoFile{}
+	if err := result.Decode(info); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error finding info file in %s: %v", folder, err)
+	}
+	return info, nil
+}
+
+func (sh *Mongo) SaveFailure(ctx context.Context, failure *Failure) error {
+	opts := options.Replace().SetUpsert(true)
+	if _, err := sh.failures.ReplaceOne(ctx, bson.D{{Key: "_id", Value: failure.Path}}, failure, opts); err != nil {
+		return fmt.Errorf("error saving failure for %s to MongoDB: %v", failure.Path, err)
+	}
+	return nil
+}
+
+func (sh *Mongo) DeleteFailure(ctx context.Context, path string) error {
+	if _, err := sh.failures.DeleteOne(ctx, bson.D{{Key: "_id", Value: path}}); err != nil {
+		return fmt.Errorf("error deleting failure for %s from MongoDB: %v", path, err)
+	}
+	return nil
+}
+
+func (sh *Mongo) SchemaVersion(ctx context.Context) (int, bool, error) {
+	v := schemaVersion{}
+	err := sh.meta.FindOne(ctx, bson.D{{Key: "_id", Value: schemaId}}).Decode(&v)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, fmt.Errorf("error reading schema version: %v", err)
+	}
+	return v.Version, true, nil
+}
+
+func (sh *Mongo) SetSchemaVersion(ctx context.Context, version int) error {
+	v := schemaVersion{Id: schemaId, Version: version, UpdatedAt: time.Now().UTC()}
+	opts := options.Replace().SetUpsert(true)
+	if _, err := sh.meta.ReplaceOne(ctx, bson.D{{Key: "_id", Value: schemaId}}, v, opts); err != nil {
+		return fmt.Errorf("error saving schema version: %v", err)
+	}
+	return nil
+}
+
+func (sh *Mongo) HasTracks(ctx context.Context) (bool, error) {
+	n, err := sh.collection.CountDocuments(ctx, bson.D{}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("error counting tracks: %v", err)
+	}
+	return n > 0, nil
+}
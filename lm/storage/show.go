@@ -0,0 +1,41 @@
+package storage
+
+import "time"
+
+// Show is a single recording of a live performance, built by grouping all of
+// the tracks that share a folder, artist, date, and source. Details missing
+// from the tracks are taken from the info file in the folder, if any.
+type Show struct {
+	Id         string        `json:"id" bson:"_id"`
+	Folder     string        `json:"folder" bson:"folder"`
+	Artist     string        `json:"artist" bson:"artist"`
+	Date       time.Time     `json:"date" bson:"date,omitempty"`
+	Source     string        `json:"source" bson:"source,omitempty"`
+	Venue      string        `json:"venue" bson:"venue,omitempty"`
+	City       string        `json:"city" bson:"city,omitempty"`
+	Lineage    string        `json:"lineage" bson:"lineage,omitempty"`
+	Taper      string        `json:"taper" bson:"taper,omitempty"`
+	Transfer   string        `json:"transfer" bson:"transfer,omitempty"`
+	InfoId     string        `json:"info_id" bson:"info_id,omitempty"`
+	Discs      []ShowDisc    `json:"discs" bson:"discs"`
+	Duration   time.Duration `json:"duration" bson:"duration"`
+	TrackCount int           `json:"track_count" bson:"track_count"`
+}
+
+type ShowDisc struct {
+	Number int       `json:"number" bson:"number"`
+	Sets   []ShowSet `json:"sets" bson:"sets"`
+}
+
+type ShowSet struct {
+	Number int         `json:"number" bson:"number"`
+	Tracks []ShowTrack `json:"tracks" bson:"tracks"`
+}
+
+type ShowTrack struct {
+	TrackId  string        `json:"track_id" bson:"track_id"`
+	Number   int           `json:"number" bson:"number"`
+	Title    string        `json:"title" bson:"title"`
+	Filename string        `json:"filename" bson:"filename"`
+	Duration time.Duration `json:"duration" bson:"duration,omitempty"`
+}
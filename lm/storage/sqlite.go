@@ -0,0 +1,340 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema creates a table for each collection. Documents are stored as
+// JSON, along with copies of the fields that they're queried by.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS tracks (
+	id TEXT PRIMARY KEY,
+	library_root TEXT NOT NULL DEFAULT '',
+	rel_path TEXT,
+	folder TEXT NOT NULL,
+	doc TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS tracks_folder ON tracks (folder);
+
+CREATE TABLE IF NOT EXISTS shows (
+	id TEXT PRIMARY KEY,
+	folder TEXT NOT NULL,
+	doc TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS shows_folder ON shows (folder);
+
+CREATE TABLE IF NOT EXISTS info (
+	id TEXT PRIMARY KEY,
+	folder TEXT NOT NULL,
+	filename TEXT NOT NULL,
+	doc TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS info_folder ON info (folder, filename);
+
+CREATE TABLE IF NOT EXISTS failures (
+	id TEXT PRIMARY KEY,
+	doc TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS meta (
+	id TEXT PRIMARY KEY,
+	doc TEXT NOT NULL
+);
+`
+
+// SQLite stores documents in an SQLite database file, for running
+// without a MongoDB server.
+type SQLite struct {
+	path string
+	db   *sql.DB
+}
+
+// column is an indexed copy of a document field.
+type column struct {
+	name  string
+	value any
+}
+
+func newSQLite(path string) (*SQLite, error) {
+	if path == "" {
+		return nil, fmt.Errorf("missing SQLite database path, expected %s/path/lm.db", sqliteScheme)
+	}
+
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("error opening SQLite database %s: %v", path, err)
+	}
+	// SQLite allows a single writer, so share one connection between workers
+	// rather than having them fail with busy errors.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating SQLite tables in %s: %v", path, err)
+	}
+	if err := upgradeSQLite(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error upgrading SQLite tables in %s: %v", path, err)
+	}
+	return &SQLite{path: path, db: db}, nil
+}
+
+// upgradeSQLite adds the library root column to tracks tables created before
+// tracks were looked up by it, filling it in from the documents.
+func upgradeSQLite(db *sql.DB) error {
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('tracks') WHERE name = 'library_root'").Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		if _, err := db.Exec(`
+ALTER TABLE tracks ADD COLUMN library_root TEXT NOT NULL DEFAULT '';
+UPDATE tracks SET library_root = COALESCE(json_extract(doc, '$.library_root'), '');
+`); err != nil {
+			return err
+		}
+	}
+	_, err := db.Exec(`
+DROP INDEX IF EXISTS tracks_rel_path;
+CREATE INDEX IF NOT EXISTS tracks_library_path ON tracks (library_root, rel_path);
+`)
+	return err
+}
+
+func (s *SQLite) Close(ctx context.Context) error {
+	return s.db.Close()
+}
+
+// upsert saves v as the document with the given id, replacing any existing
+// document. As with MongoDB, replacing a document with an identical one leaves
+// it unchanged.
+func (s *SQLite) upsert(ctx context.Context, table, id string, v any, columns ...column) (SaveResult, error) {
+	doc, err := json.Marshal(v)
+	if err != nil {
+		return SaveUnchanged, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return SaveUnchanged, err
+	}
+	defer tx.Rollback()
+
+	result := SaveUpdated
+	var existing string
+	err = tx.QueryRowContext(ctx, "SELECT doc FROM "+table+" WHERE id = ?", id).Scan(&existing)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		result = SaveInserted
+	case err != nil:
+		return SaveUnchanged, err
+	case existing == string(doc):
+		return SaveUnchanged, nil
+	}
+
+	names := []string{"id", "doc"}
+	values := []any{id, string(doc)}
+	for _, c := range columns {
+		names = append(names, c.name)
+		values = append(values, c.value)
+	}
+	query := fmt.Sprintf("INSERT OR REPLACE INTO %s (%s) VALUES (?%s)",
+		table, strings.Join(names, ", "), strings.Repeat(", ?", len(names)-1))
+	if _, err := tx.ExecContext(ctx, query, values...); err != nil {
+		return SaveUnchanged, err
+	}
+	return result, tx.Commit()
+}
+
+// queryDocs decodes the documents returned by query.
+func queryDocs[T any](ctx context.Context, db *sql.DB, query string, args ...any) ([]*T, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs := []*T{}
+	for rows.Next() {
+		var doc string
+		if err := rows.Scan(&doc); err != nil {
+			return nil, err
+		}
+		v := new(T)
+		if err := json.Unmarshal([]byte(doc), v); err != nil {
+			return nil, err
+		}
+		docs = append(docs, v)
+	}
+	return docs, rows.Err()
+}
+
+// queryDoc returns the first document returned by query, or nil if there
+// isn't one.
+func queryDoc[T any](ctx context.Context, db *sql.DB, query string, args ...any) (*T, error) {
+	docs, err := queryDocs[T](ctx, db, query, args...)
+	if err != nil || len(docs) == 0 {
+		return nil, err
+	}
+	return docs[0], nil
+}
+
+func (s *SQLite) SaveMetadata(ctx context.Context, metadata *Metadata) (SaveResult, error) {
+	result, err := s.upsert(ctx, "tracks", metadata.Id, metadata,
+		column{"library_root", metadata.LibraryRoot}, column{"rel_path", metadata.RelPath}, column{"folder", metadata.Folder})
+	if err != nil {
+		return SaveUnchanged, fmt.Errorf("error saving metadata to SQLite: %v", err)
+	}
+	return result, nil
+}
+
+func (s *SQLite) FindTrackByRelPath(ctx context.Context, libraryRoot, relPath string) (*Metadata, error) {
+	track, err := queryDoc[Metadata](ctx, s.db, "SELECT doc FROM tracks WHERE library_root = ? AND rel_path = ? LIMIT 1", libraryRoot, relPath)
+	if err != nil {
+		return nil, fmt.Errorf("error finding track %s: %v", relPath, err)
+	}
+	return track, nil
+}
+
+func (s *SQLite) FindLegacyTracks(ctx context.Context) ([]*Metadata, error) {
+	tracks, err := queryDocs[Metadata](ctx, s.db, "SELECT doc FROM tracks WHERE rel_path IS NULL")
+	if err != nil {
+		return nil, fmt.Errorf("error finding legacy tracks: %v", err)
+	}
+	return tracks, nil
+}
+
+func (s *SQLite) DeleteTrack(ctx context.Context, id string) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM tracks WHERE id = ?", id); err != nil {
+		return fmt.Errorf("error deleting track %s from SQLite: %v", id, err)
+	}
+	return nil
+}
+
+func (s *SQLite) FindTracksByFolder(ctx context.Context, folder string) ([]*Metadata, error) {
+	tracks, err := queryDocs[Metadata](ctx, s.db, "SELECT doc FROM tracks WHERE folder = ?", folder)
+	if err != nil {
+		return nil, fmt.Errorf("error finding tracks in %s: %v", folder, err)
+	}
+	return tracks, nil
+}
+
+func (s *SQLite) SaveVerification(ctx context.Context, folder, filename string, v *Verification) (int64, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return 0, fmt.Errorf("error encoding verification of %s in %s: %v", filename, folder, err)
+	}
+	result, err := s.db.ExecContext(ctx, "UPDATE tracks SET doc = json_set(doc, '$.verification', json(?)) WHERE folder = ? AND json_extract(doc, '$.filename') = ?",
+		string(b), folder, filename)
+	if err != nil {
+		return 0, fmt.Errorf("error recording verification of %s in %s: %v", filename, folder, err)
+	}
+	return result.RowsAffected()
+}
+
+func (s *SQLite) FindShowsByFolder(ctx context.Context, folder string) ([]*Show, error) {
+	shows, err := queryDocs[Show](ctx, s.db, "SELECT doc FROM shows WHERE folder = ? ORDER BY id", folder)
+	if err != nil {
+		return nil, fmt.Errorf("error finding shows in %s: %v", folder, err)
+	}
+	return shows, nil
+}
+
+func (s *SQLite) ReplaceShows(ctx context.Context, folder string, shows []*Show) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error replacing shows in %s: %v", folder, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM shows WHERE folder = ?", folder); err != nil {
+		return fmt.Errorf("error removing shows in %s from SQLite: %v", folder, err)
+	}
+	for _, show := range shows {
+		doc, err := json.Marshal(show)
+		if err != nil {
+			return fmt.Errorf("error encoding show %s: %v", show.Id, err)
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO shows (id, folder, doc) VALUES (?, ?, ?)", show.Id, folder, string(doc)); err != nil {
+			return fmt.Errorf("error saving shows in %s to SQLite: %v", folder, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLite) SaveInfo(ctx context.Context, info *InfoFile) (SaveResult, error) {
+	result, err := s.upsert(ctx, "info", info.Id, info,
+		column{"folder", info.Folder}, column{"filename", info.Filename})
+	if err != nil {
+		return SaveUnchanged, fmt.Errorf("error saving info file to SQLite: %v", err)
+	}
+	return result, nil
+}
+
+func (s *SQLite) DeleteInfo(ctx context.Context, id string) (SaveResult, error) {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM info WHERE id = ?", id)
+	if err != nil {
+		return SaveUnchanged, fmt.Errorf("error deleting info file %s from SQLite: %v", id, err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return SaveUnchanged, err
+	}
+	return SaveRemoved, nil
+}
+
+func (s *SQLite) FindInfoByFolder(ctx context.Context, folder string) (*InfoFile, error) {
+	info, err := queryDoc[InfoFile](ctx, s.db, "SELECT doc FROM info WHERE folder = ? ORDER BY filename LIMIT 1", folder)
+	if err != nil {
+		return nil, fmt.Errorf("error finding info file in %s: %v", folder, err)
+	}
+	return info, nil
+}
+
+func (s *SQLite) SaveFailure(ctx context.Context, failure *Failure) error {
+	if _, err := s.upsert(ctx, "failures", failure.Path, failure); err != nil {
+		return fmt.Errorf("error saving failure for %s to SQLite: %v", failure.Path, err)
+	}
+	return nil
+}
+
+func (s *SQLite) DeleteFailure(ctx context.Context, path string) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM failures WHERE id = ?", path); err != nil {
+		return fmt.Errorf("error deleting failure for %s from SQLite: %v", path, err)
+	}
+	return nil
+}
+
+func (s *SQLite) SchemaVersion(ctx context.Context) (int, bool, error) {
+	v, err := queryDoc[schemaVersion](ctx, s.db, "SELECT doc FROM meta WHERE id = ?", schemaId)
+	if err != nil {
+		return 0, false, fmt.Errorf("error reading schema version: %v", err)
+	}
+	if v == nil {
+		return 0, false, nil
+	}
+	return v.Version, true, nil
+}
+
+func (s *SQLite) SetSchemaVersion(ctx context.Context, version int) error {
+	v := schemaVersion{Id: schemaId, Version: version, UpdatedAt: time.Now().UTC()}
+	if _, err := s.upsert(ctx, "meta", schemaId, v); err != nil {
+		return fmt.Errorf("error saving schema version: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLite) HasTracks(ctx context.Context) (bool, error) {
+	var n int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM (SELECT 1 FROM tracks LIMIT 1)").Scan(&n); err != nil {
+		return false, fmt.Errorf("error counting tracks: %v", err)
+	}
+	return n > 0, nil
+}
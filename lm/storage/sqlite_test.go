@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestSQLite(t *testing.T) *SQLite {
+	t.Helper()
+	s, err := newSQLite(filepath.Join(t.TempDir(), "lm.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close(context.Background()) })
+	return s
+}
+
+func TestSQLiteSaveMetadata(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLite(t)
+
+	track := func(id, title string) *Metadata {
+		return &Metadata{
+			Id:          id,
+			Filename:    "gd77-05-08d1t01.flac",
+			Folder:      "/music/gd1977-05-08.sbd",
+			Title:       title,
+			LibraryRoot: "/music",
+			RelPath:     "gd1977-05-08.sbd/gd77-05-08d1t01.flac",
+		}
+	}
+	tests := []struct {
+		name  string
+		track *Metadata
+		want  SaveResult
+	}{
+		{"inserted", track("a", "New Minglewood Blues"), SaveInserted},
+		{"unchanged", track("a", "New Minglewood Blues"), SaveUnchanged},
+		{"updated", track("a", "Minglewood Blues"), SaveUpdated},
+		{"other track", track("b", "Minglewood Blues"), SaveInserted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := s.SaveMetadata(ctx, tt.track)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != tt.want {
+				t.Errorf("SaveMetadata() = %v, want %v", result, tt.want)
+			}
+		})
+	}
+
+	// Replacing a track, as when its audio changes, saves it under its new
+	// identifier and then deletes the old one.
+	if err := s.DeleteTrack(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.FindTrackByRelPath(ctx, "/music", "gd1977-05-08.sbd/gd77-05-08d1t01.flac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := track("b", "Minglewood Blues"); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindTrackByRelPath() = %+v, want %+v", got, want)
+	}
+
+	tracks, err := s.FindTracksByFolder(ctx, "/music/gd1977-05-08.sbd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 1 || tracks[0].Id != "b" {
+		t.Errorf("FindTracksByFolder() = %+v, want track b", tracks)
+	}
+}
+
+func TestSQLiteFindTrackByRelPath(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLite(t)
+
+	for _, m := range []*Metadata{
+		{Id: "a", Folder: "/music/show", LibraryRoot: "/music", RelPath: "show/t01.flac"},
+		{Id: "b", Folder: "/backup/show", LibraryRoot: "/backup", RelPath: "show/t01.flac"},
+		{Id: "c", Folder: "/tmp/show", RelPath: "tmp/show/t01.flac"},
+	} {
+		if _, err := s.SaveMetadata(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		libraryRoot string
+		relPath     string
+		want        string
+	}{
+		{"library root", "/music", "show/t01.flac", "a"},
+		{"other library root", "/backup", "show/t01.flac", "b"},
+		{"outside library roots", "", "tmp/show/t01.flac", "c"},
+		{"missing", "/music", "show/t02.flac", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.FindTrackByRelPath(ctx, tt.libraryRoot, tt.relPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			id := ""
+			if got != nil {
+				id = got.Id
+			}
+			if id != tt.want {
+				t.Errorf("FindTrackByRelPath(%q, %q) = %q, want %q", tt.libraryRoot, tt.relPath, id, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLiteReplaceShows(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLite(t)
+
+	date := time.Date(1977, 5, 8, 0, 0, 0, 0, time.UTC)
+	show := func(id, source string) *Show {
+		return &Show{
+			Id:     id,
+			Folder: "/music/gd1977-05-08",
+			Artist: "Grateful Dead",
+			Date:   date,
+			Source: source,
+			Discs: []ShowDisc{{Number: 1, Sets: []ShowSet{{Number: 1, Tracks: []ShowTrack{
+				{TrackId: "a", Number: 1, Title: "New Minglewood Blues", Filename: "gd77-05-08d1t01.flac"},
+			}}}}},
+			TrackCount: 1,
+		}
+	}
+	other := &Show{Id: "other", Folder: "/music/gd1977-05-09", Discs: []ShowDisc{}}
+
+	// Shows are found in order of their identifiers
+	steps := []struct {
+		name  string
+		shows []*Show
+		want  []*Show
+	}{
+		{"first", []*Show{show("sbd", "sbd"), show("aud", "aud")}, []*Show{show("aud", "aud"), show("sbd", "sbd")}},
+		{"replaced", []*Show{show("sbd", "sbd.miller")}, []*Show{show("sbd", "sbd.miller")}},
+		{"removed", []*Show{}, []*Show{}},
+	}
+	if err := s.ReplaceShows(ctx, other.Folder, []*Show{other}); err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			if err := s.ReplaceShows(ctx, "/music/gd1977-05-08", step.shows); err != nil {
+				t.Fatal(err)
+			}
+			got, err := s.FindShowsByFolder(ctx, "/music/gd1977-05-08")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, step.want) {
+				t.Errorf("FindShowsByFolder() = %+v, want %+v", got, step.want)
+			}
+		})
+	}
+
+	// Shows in other folders are left alone
+	got, err := s.FindShowsByFolder(ctx, other.Folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []*Show{other}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindShowsByFolder(%q) = %+v, want %+v", other.Folder, got, want)
+	}
+}
+
+func TestSQLiteInfo(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLite(t)
+
+	info := &InfoFile{Id: "/music/show/info.txt", Filename: "info.txt", Folder: "/music/show", Venue: "Barton Hall"}
+	if result, err := s.SaveInfo(ctx, info); err != nil || result != SaveInserted {
+		t.Fatalf("SaveInfo() = %v, %v, want %v", result, err, SaveInserted)
+	}
+	got, err := s.FindInfoByFolder(ctx, "/music/show")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, info) {
+		t.Errorf("FindInfoByFolder() = %+v, want %+v", got, info)
+	}
+
+	if result, err := s.DeleteInfo(ctx, info.Id); err != nil || result != SaveRemoved {
+		t.Errorf("DeleteInfo() = %v, %v, want %v", result, err, SaveRemoved)
+	}
+	if result, err := s.DeleteInfo(ctx, info.Id); err != nil || result != SaveUnchanged {
+		t.Errorf("DeleteInfo() again = %v, %v, want %v", result, err, SaveUnchanged)
+	}
+}
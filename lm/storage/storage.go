@@ -0,0 +1,103 @@
+// Package storage saves the tracks, shows, info files, and failures found by
+// analyze, in MongoDB or in an SQLite database file.
+package storage
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+const (
+	databaseName        = "lm"
+	collectionName      = "tracks"
+	showsCollectionName = "shows"
+	infoCollectionName  = "info"
+
+	failuresCollectionName = "failures"
+	metaCollectionName     = "meta"
+
+	sqliteScheme = "sqlite://"
+)
+
+// Handler saves and queries tracks, shows, info files, and failures.
+// Backends must behave the same, so that the rest of analyze doesn't depend
+// on which one is in use.
+type Handler interface {
+	// SaveMetadata inserts the metadata for a track, or replaces it if a
+	// track with the same identifier has already been saved.
+	SaveMetadata(ctx context.Context, metadata *Metadata) (SaveResult, error)
+	// FindTrackByRelPath returns the track saved for a path relative to a
+	// library root, or nil if there isn't one. libraryRoot is "" for tracks
+	// outside every library root.
+	FindTrackByRelPath(ctx context.Context, libraryRoot, relPath string) (*Metadata, error)
+	// FindLegacyTracks returns the tracks saved before tracks were identified
+	// by their library relative path.
+	FindLegacyTracks(ctx context.Context) ([]*Metadata, error)
+	DeleteTrack(ctx context.Context, id string) error
+	FindTracksByFolder(ctx context.Context, folder string) ([]*Metadata, error)
+	// SaveVerification records the result of checking the tracks called
+	// filename in folder against a checksum manifest, returning how many
+	// tracks it was recorded on.
+	SaveVerification(ctx context.Context, folder, filename string, v *Verification) (int64, error)
+
+	FindShowsByFolder(ctx context.Context, folder string) ([]*Show, error)
+	// ReplaceShows replaces all of the shows stored for a folder.
+	ReplaceShows(ctx context.Context, folder string, shows []*Show) error
+
+	SaveInfo(ctx context.Context, info *InfoFile) (SaveResult, error)
+	// DeleteInfo removes an info file, returning SaveRemoved if it was
+	// stored.
+	DeleteInfo(ctx context.Context, id string) (SaveResult, error)
+	// FindInfoByFolder returns the first info file stored for a folder, by
+	// filename, or nil if there isn't one.
+	FindInfoByFolder(ctx context.Context, folder string) (*InfoFile, error)
+
+	// SaveFailure records the latest failure to analyze a file.
+	SaveFailure(ctx context.Context, failure *Failure) error
+	// DeleteFailure removes the recorded failure for a file once it has been
+	// analyzed successfully.
+	DeleteFailure(ctx context.Context, path string) error
+
+	Close(ctx context.Context) error
+}
+
+// Open returns the backend for uri: SQLite for sqlite:///path/lm.db, and
+// MongoDB otherwise.
+func Open(uri string) (Handler, error) {
+	if path, ok := strings.CutPrefix(uri, sqliteScheme); ok {
+		return newSQLite(path)
+	}
+	return newMongo(uri)
+}
+
+// Versioned is implemented by the backends that record the version of the
+// schema their documents follow, so that `lm db migrate` knows which
+// migrations to apply.
+type Versioned interface {
+	// SchemaVersion returns the schema version, and whether one has been
+	// recorded at all.
+	SchemaVersion(ctx context.Context) (int, bool, error)
+	SetSchemaVersion(ctx context.Context, version int) error
+	// HasTracks reports whether any tracks have been saved.
+	HasTracks(ctx context.Context) (bool, error)
+}
+
+// schemaId is the identifier of the document that holds the schema version.
+const schemaId = "schema"
+
+type schemaVersion struct {
+	Id        string    `json:"id" bson:"_id"`
+	Version   int       `json:"version" bson:"version"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// SaveResult describes the effect of saving a document.
+type SaveResult int
+
+const (
+	SaveUnchanged SaveResult = iota
+	SaveInserted
+	SaveUpdated
+	SaveRemoved
+)
@@ -0,0 +1,86 @@
+package storage
+
+import "time"
+
+type Metadata struct {
+	Id       string        `json:"id" bson:"_id"`
+	Filename string        `json:"filename" bson:"filename"`
+	Folder   string        `json:"folder" bson:"folder"`
+	Path     string        `json:"path" bson:"path"`
+	Album    string        `json:"album" bson:"album"`
+	Artist   string        `json:"artist" bson:"artist"`
+	Date     time.Time     `json:"date" bson:"date,omitempty"`
+	Disc     int           `json:"disc" bson:"disc,omitempty"`
+	Duration time.Duration `json:"duration" bson:"duration,omitempty"`
+	Genre    []string      `json:"genre" bson:"genre,omitempty"`
+	Set      int           `json:"set" bson:"set,omitempty"`
+	ShowId   string        `json:"show_id" bson:"show_id"`
+	Source   string        `json:"source" bson:"source,omitempty"`
+	Taper    string        `json:"taper" bson:"taper,omitempty"`
+	Title    string        `json:"title" bson:"title"`
+	Track    int           `json:"track" bson:"track,omitempty"`
+	Venue    string        `json:"venue" bson:"venue,omitempty"`
+
+	// Shnid is the etree.org database identifier of the recording.
+	Shnid string `json:"shnid" bson:"shnid,omitempty"`
+
+	// Technical properties of the audio stream. Bitrate is the average in
+	// bits per second.
+	Codec      string `json:"codec" bson:"codec,omitempty"`
+	BitDepth   int    `json:"bit_depth" bson:"bit_depth,omitempty"`
+	Bitrate    int    `json:"bitrate" bson:"bitrate,omitempty"`
+	Channels   int    `json:"channels" bson:"channels,omitempty"`
+	SampleRate int    `json:"sample_rate" bson:"sample_rate,omitempty"`
+	Samples    int64  `json:"samples" bson:"samples,omitempty"`
+
+	AccousticIdFingerprint string `json:"accoustic_id_fingerprint" bson:"accoustic_id_fingerprint,omitempty"`
+	// AudioMD5 is the MD5 signature of the decoded audio, as listed in FLAC
+	// fingerprint (.ffp) files. It identifies the same audio regardless of
+	// filename, tags, or encoder settings.
+	AudioMD5    string      `json:"audio_md5" bson:"audio_md5,omitempty"`
+	MusicBrainz MusicBrainz `json:"music_brainz" bson:"music_brainz,omitempty"`
+
+	Tags map[string]string `json:"tags" bson:"tags,omitempty"`
+
+	// LibraryRoot is the library root the file was found in, and RelPath is
+	// the slash separated path of the file relative to it.
+	LibraryRoot string `json:"library_root" bson:"library_root,omitempty"`
+	RelPath     string `json:"rel_path" bson:"rel_path"`
+	// ContentHash is a hash of the audio that ignores tags.
+	ContentHash string `json:"content_hash" bson:"content_hash"`
+
+	// Size and ModTime of the file when it was analyzed, used to skip
+	// unchanged files.
+	Size    int64     `json:"size" bson:"size"`
+	ModTime time.Time `json:"mod_time" bson:"mod_time"`
+
+	// Verification is set by `lm verify --record`.
+	Verification *Verification `json:"verification,omitempty" bson:"verification,omitempty"`
+}
+
+// Verification is the result of checking a track against a checksum manifest.
+type Verification struct {
+	Status     string    `json:"status" bson:"status"`
+	Kind       string    `json:"kind" bson:"kind"`
+	Manifest   string    `json:"manifest" bson:"manifest"`
+	VerifiedAt time.Time `json:"verified_at" bson:"verified_at"`
+}
+
+type MusicBrainz struct {
+	// Unique ID of the artist or band. For example, Rush has the artist id of
+	// "534ee493-bfac-4575-a44a-0ae41e2c3fe4".
+	ArtistId string `json:"artist_id" bson:"artist_id"`
+
+	// Release group is what most people would call an "album". For example,
+	// the album titled "Roll the Bones" by Rush has an release group id of
+	// "e188de4e-6d15-3ca3-be49-fa13c67a03c0".
+	ReleaseGroupId string `json:"release_group_id" bson:"release_group_id"`
+
+	// Release is a specific edition of an album. For example, the album
+	// titled "Roll the Bones" by Rush has had at least 13 different releases
+	// around the world. The original US CD release by Atlantic on 1991-09-03
+	// has the release id of "50e551bd-5d24-37e5-913d-07c25cd85e8e". Whereas
+	// the original 12" vinyl release by Atlantic was worldwide and has the
+	// release id of "52bf9926-dc7f-40b9-9a08-d5f0c98f8a63".
+	ReleaseId string `json:"release_id" bson:"release_id"`
+}
@@ -1,3 +1,6 @@
+// Prefer `lm db init`, which also creates indexes and validators and records
+// the schema version for `lm db migrate`.
+
 const database = 'lm';
 const collection = 'tracks';
 
@@ -6,3 +9,6 @@ use(database);
 
 // Create a new collection.
 db.createCollection(collection);
+db.createCollection('shows');
+db.createCollection('info');
+db.createCollection('failures');